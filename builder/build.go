@@ -9,10 +9,11 @@ import (
 	"sort"
 
 	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/verifa/terraplate/parser"
 	"github.com/zclconf/go-cty/cty"
-	"github.com/zclconf/go-cty/cty/gocty"
 )
 
 var errorColor = color.New(color.FgRed, color.Bold)
@@ -20,51 +21,112 @@ var errorColor = color.New(color.FgRed, color.Bold)
 // BuildTerrafile takes an input Terrafile and builds it, writing any output
 // to the provided io.Writer
 func BuildTerrafile(tf *parser.Terrafile, out io.Writer) error {
-	if err := buildTerraplate(tf, out); err != nil {
+	previous, readErr := readManifest(tf)
+	if readErr != nil {
+		buildErr := fmt.Errorf("reading build manifest: %w", readErr)
+		fmt.Fprintf(out, "\n%s: %v", errorColor.Sprint("Error"), buildErr)
+		return buildErr
+	}
+	var manifest = &buildManifest{}
+	for _, dep := range tf.Dependencies {
+		if dep.Outputs == nil && dep.HasMockOutputs() && !dep.MockOutputsAllowedOnApply {
+			manifest.MockOutputs = append(manifest.MockOutputs, dep.Name)
+		}
+	}
+
+	if err := buildTerraplate(tf, manifest, out); err != nil {
 		buildErr := fmt.Errorf("building Terraplate Terraform file: %w", err)
 		fmt.Fprintf(out, "\n%s: %v", errorColor.Sprint("Error"), buildErr)
 		return buildErr
 	}
 
-	if err := buildTemplates(tf, out); err != nil {
+	if err := buildTemplates(tf, manifest, out); err != nil {
 		buildErr := fmt.Errorf("building templates: %w", err)
 		fmt.Fprintf(out, "\n%s: %v", errorColor.Sprint("Error"), buildErr)
 		return buildErr
 	}
+
+	// Only clean up once everything has been built, so that a failed build
+	// does not delete any files
+	if err := deleteStaleFiles(tf, previous, manifest, out); err != nil {
+		buildErr := fmt.Errorf("deleting stale files: %w", err)
+		fmt.Fprintf(out, "\n%s: %v", errorColor.Sprint("Error"), buildErr)
+		return buildErr
+	}
+	if err := manifest.write(tf); err != nil {
+		buildErr := fmt.Errorf("writing build manifest: %w", err)
+		fmt.Fprintf(out, "\n%s: %v", errorColor.Sprint("Error"), buildErr)
+		return buildErr
+	}
 	return nil
 }
 
-// buildTemplates builds the templates associated with the given terrafile
-func buildTemplates(tf *parser.Terrafile, out io.Writer) error {
+// buildTemplates builds the templates associated with the given terrafile,
+// adding the generated files to the manifest
+func buildTemplates(tf *parser.Terrafile, manifest *buildManifest, out io.Writer) error {
 	for _, tmpl := range tf.Templates {
-		target := filepath.Join(tf.Dir, tmpl.Target)
-		fmt.Fprintf(out, "Building template %s to %s\n", tmpl.Name, target)
-
+		if !tmpl.IsEnabled() {
+			continue
+		}
 		data, dataErr := tf.BuildData()
 		if dataErr != nil {
 			return fmt.Errorf("getting build data for %s: %w", tf.Path, dataErr)
 		}
-		if tmpl.ConditionAttr != "" {
-			condition, condErr := tmpl.Condition(data)
-			if condErr != nil {
-				return fmt.Errorf("evaluating condition for %s: %w", tf.Path, condErr)
+		// Templates using for_each build a file for each element
+		var targets = make(map[string]string)
+		for _, eachData := range tmpl.EachData(data) {
+			targetPath, targetErr := tmpl.TargetPath(eachData)
+			if targetErr != nil {
+				return targetErr
+			}
+			if eachData.Each != nil {
+				if otherKey, ok := targets[targetPath]; ok {
+					return tmpl.Diagnostics("Duplicate template target", fmt.Errorf("template %s builds the same target %s for the keys \"%s\" and \"%s\": the target should include {{ .Each.Key }}", tmpl.Name, targetPath, otherKey, eachData.Each.Key))
+				}
+				targets[targetPath] = eachData.Each.Key
 			}
-			if !condition {
-				continue
+			if err := buildTemplate(tf, tmpl, eachData, filepath.Join(tf.Dir, targetPath), manifest, out); err != nil {
+				return err
 			}
 		}
+	}
+	return nil
+}
 
-		content := defaultTemplateHeader(tf, tmpl) + tmpl.Contents
-		if err := parser.TemplateWrite(data, tmpl.Name, content, target); err != nil {
-			return fmt.Errorf("creating template %s in terrafile %s: %w", tmpl.Name, tf.RelativePath(), err)
+// buildTemplate builds a template to the target, unless its condition is false
+func buildTemplate(tf *parser.Terrafile, tmpl *parser.TerraTemplate, data *parser.BuildData, target string, manifest *buildManifest, out io.Writer) error {
+	fmt.Fprintf(out, "Building template %s to %s\n", tmpl.Name, target)
+	if tmpl.ConditionAttr != "" {
+		condition, condErr := tmpl.Condition(data)
+		if condErr != nil {
+			return condErr
+		}
+		if !condition {
+			return nil
 		}
 	}
-	return nil
+
+	contents, execErr := parser.ExecTemplate(data, tmpl.Name, tmpl.Contents)
+	if execErr != nil {
+		return tmpl.Diagnostics("Failed to build template", fmt.Errorf("creating template %s in terrafile %s: %w", tmpl.Name, tf.RelativePath(), execErr))
+	}
+	header, explicit, headerErr := headerText(tf, tmpl, data)
+	if headerErr != nil {
+		return tmpl.Diagnostics("Invalid template header", fmt.Errorf("creating header for template %s in terrafile %s: %w", tmpl.Name, tf.RelativePath(), headerErr))
+	}
+	withHeader, hasHeader := addHeader(tf, target, header, explicit, contents.Bytes())
+	if err := parser.WriteTarget(target, withHeader, tmpl.ShouldFormat()); err != nil {
+		return tmpl.Diagnostics("Failed to build template", fmt.Errorf("creating template %s in terrafile %s: %w", tmpl.Name, tf.RelativePath(), err))
+	}
+	if !hasHeader {
+		header = ""
+	}
+	return manifest.add(tf, target, header)
 }
 
 // buildTerraplate builds the terraplate terraform file which contains the
 // variables (with defaults) and terraform block
-func buildTerraplate(terrafile *parser.Terrafile, out io.Writer) error {
+func buildTerraplate(terrafile *parser.Terrafile, manifest *buildManifest, out io.Writer) error {
 
 	path := filepath.Join(terrafile.Dir, "terraplate.tf")
 	fmt.Fprintf(out, "Building terraplate.tf file to %s\n", path)
@@ -86,25 +148,52 @@ func buildTerraplate(terrafile *parser.Terrafile, out io.Writer) error {
 	provMap := terrafile.TerraformBlock.RequiredProviders()
 	if len(provMap) > 0 {
 		for _, name := range sortedMapKeys(provMap) {
-			value := provMap[name]
-			ctyType, typeErr := gocty.ImpliedType(value)
-			if typeErr != nil {
-				return fmt.Errorf("implying required provider to cty type for provider %s: %w", name, typeErr)
-			}
-			ctyValue, ctyErr := gocty.ToCtyValue(value, ctyType)
-			if ctyErr != nil {
-				return fmt.Errorf("converting required provider to cty value for provider %s: %w", name, ctyErr)
-			}
-			provBlock.Body().SetAttributeValue(name, ctyValue)
+			provBlock.Body().SetAttributeRaw(name, provMap[name].Tokens())
 		}
 		tfBlock.Body().AppendBlock(provBlock)
 	}
+	// Write the experiments as they are, as they are not valid expressions
+	if experiments := terrafile.TerraformBlock.Experiments; experiments != nil {
+		tokens, err := exprTokens(experiments.Expr)
+		if err != nil {
+			return fmt.Errorf("building experiments: %w", err)
+		}
+		tfBlock.Body().SetAttributeRaw("experiments", tokens)
+	}
+	// Write the cloud and provider_meta blocks if they were given
+	if cloud := terrafile.TerraformBlock.CloudBlock; cloud != nil {
+		tfBlock.Body().AppendBlock(cloud.Block)
+	}
+	for _, meta := range terrafile.TerraformBlock.ProviderMetas {
+		tfBlock.Body().AppendBlock(meta.Block)
+	}
+	// Write the backend block if one was given
+	if backend := terrafile.BackendBlock; backend != nil {
+		backendBlock := hclwrite.NewBlock("backend", []string{backend.Type})
+		for _, name := range sortedMapKeys(backend.Config) {
+			backendBlock.Body().SetAttributeValue(name, backend.Config[name])
+		}
+		if isBodyEmpty(tfBlock.Body()) {
+			tfBlock.Body().AppendNewline()
+		}
+		tfBlock.Body().AppendBlock(backendBlock)
+	}
 	// If body is not empty, write the terraform block
 	if isBodyEmpty(tfBlock.Body()) {
 		tfFile.Body().AppendBlock(tfBlock)
 		tfFile.Body().AppendNewline()
 	}
 
+	//
+	// Write the provider {} blocks
+	//
+	for _, provider := range terrafile.Providers {
+		for _, block := range provider.Blocks {
+			tfFile.Body().AppendBlock(block)
+			tfFile.Body().AppendNewline()
+		}
+	}
+
 	//
 	// Write the locals {} block
 	//
@@ -127,48 +216,96 @@ func buildTerraplate(terrafile *parser.Terrafile, out io.Writer) error {
 	// changes each time.
 	// Iterate over the sorted keys and then extract the value for that key
 	varMap := terrafile.Variables()
-	for _, name := range sortedMapKeys(varMap) {
-		value := varMap[name]
+	for _, name := range terrafile.VariableNames() {
 		varBlock := hclwrite.NewBlock("variable", []string{name})
-		varBlock.Body().SetAttributeValue("default", value)
+		if err := buildVariable(varBlock.Body(), name, terrafile.VariableBlock(name), varMap); err != nil {
+			return fmt.Errorf("building variable %s: %w", name, err)
+		}
 		tfFile.Body().AppendBlock(varBlock)
 		tfFile.Body().AppendNewline()
 	}
 
+	data, dataErr := terrafile.BuildData()
+	if dataErr != nil {
+		return fmt.Errorf("getting build data for %s: %w", terrafile.Path, dataErr)
+	}
+	header, explicit, headerErr := headerText(terrafile, nil, data)
+	if headerErr != nil {
+		return headerErr
+	}
+	contents, _ := addHeader(terrafile, path, header, explicit, tfFile.Bytes())
+
 	// Create and write the file
 	file, createErr := os.Create(path)
 	if createErr != nil {
 		return fmt.Errorf("creating file %s: %w", path, createErr)
 	}
-
-	contents := tfFile.Bytes()
-	header := []byte(defaultTerraplateHeader(terrafile))
-	contents = append(header, contents...)
-
 	defer file.Close()
 	if _, writeErr := file.Write(hclwrite.Format(hclwrite.Format(contents))); writeErr != nil {
 		return fmt.Errorf("writing file %s: %w", path, writeErr)
 	}
-	return nil
+	return manifest.add(terrafile, path, header)
 }
 
-func defaultTemplateHeader(tf *parser.Terrafile, tmpl *parser.TerraTemplate) string {
-	return fmt.Sprintf(`#
-	# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
-	#
-	# Terrafile: %s
-	# Template: %s
-
-	`, tf.RelativePath(), tmpl.Name)
+// buildVariable writes the body of a variable block. If the variable was
+// declared using a variable{} block, the type, description, validation, etc.
+// are also written
+func buildVariable(body *hclwrite.Body, name string, variable *parser.TerraVariable, varMap map[string]cty.Value) error {
+	if variable == nil {
+		body.SetAttributeValue("default", varMap[name])
+		return nil
+	}
+	if variable.Type != nil {
+		tokens, err := exprTokens(variable.Type.Expr)
+		if err != nil {
+			return err
+		}
+		body.SetAttributeRaw("type", tokens)
+	}
+	if variable.Description != "" {
+		body.SetAttributeValue("description", cty.StringVal(variable.Description))
+	}
+	if value, ok := varMap[name]; ok {
+		body.SetAttributeValue("default", value)
+	}
+	if variable.Sensitive != nil {
+		body.SetAttributeValue("sensitive", cty.BoolVal(*variable.Sensitive))
+	}
+	if variable.Nullable != nil {
+		body.SetAttributeValue("nullable", cty.BoolVal(*variable.Nullable))
+	}
+	for _, validation := range variable.Validations {
+		condTokens, err := exprTokens(validation.Condition.Expr)
+		if err != nil {
+			return err
+		}
+		msgTokens, err := exprTokens(validation.ErrorMessage.Expr)
+		if err != nil {
+			return err
+		}
+		valBlock := hclwrite.NewBlock("validation", nil)
+		valBlock.Body().SetAttributeRaw("condition", condTokens)
+		valBlock.Body().SetAttributeRaw("error_message", msgTokens)
+		body.AppendNewline()
+		body.AppendBlock(valBlock)
+	}
+	return nil
 }
 
-func defaultTerraplateHeader(tf *parser.Terrafile) string {
-	return fmt.Sprintf(`#
-	# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
-	#
-	# Terrafile: %s
-
-	`, tf.RelativePath())
+// exprTokens returns the tokens of an expression as it was written in the
+// Terrafile, so that it can be written without being evaluated
+func exprTokens(expr hcl.Expression) (hclwrite.Tokens, error) {
+	exprRange := expr.Range()
+	src, readErr := os.ReadFile(exprRange.Filename)
+	if readErr != nil {
+		return nil, fmt.Errorf("reading expression source %s: %w", exprRange.String(), readErr)
+	}
+	return hclwrite.Tokens{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: exprRange.SliceBytes(src),
+		},
+	}, nil
 }
 
 // sortedMapKeys takes an input map and returns its keys sorted by alphabetical order
@@ -0,0 +1,105 @@
+package builder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/verifa/terraplate/parser"
+)
+
+// testTerrafile writes the files to a temporary directory, and parses and
+// returns the root module in it
+func testTerrafile(t *testing.T, files map[string]string) *parser.Terrafile {
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	return parseRootModule(t, dir)
+}
+
+// writeFiles writes the files, which are relative to the directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+// parseRootModule parses the directory and returns the root module in it
+func parseRootModule(t *testing.T, dir string) *parser.Terrafile {
+	config, err := parser.Parse(&parser.Config{
+		Chdir: dir,
+	})
+	require.NoError(t, err)
+	rootModules := config.RootModules()
+	require.Len(t, rootModules, 1)
+	return rootModules[0]
+}
+
+// readTarget returns the contents of a file built in the root module
+func readTarget(t *testing.T, tf *parser.Terrafile, target string) string {
+	contents, err := os.ReadFile(filepath.Join(tf.Dir, filepath.FromSlash(target)))
+	require.NoError(t, err)
+	return string(contents)
+}
+
+func TestBuildVariable(t *testing.T) {
+	tf := testTerrafile(t, map[string]string{
+		"terraplate.hcl": `
+build {
+  header = ""
+}
+
+variables {
+  tags = { team = "platform" }
+}
+
+variable "region" {
+  type        = string
+  description = "The region to deploy to"
+  default     = "eu-west-1"
+  nullable    = false
+
+  validation {
+    condition     = can(regex("^eu-", var.region))
+    error_message = "The region must be in the EU."
+  }
+}
+
+variable "password" {
+  type      = string
+  sensitive = true
+}
+`,
+	})
+	require.NoError(t, BuildTerrafile(tf, io.Discard))
+
+	expected := `variable "password" {
+  type      = string
+  sensitive = true
+}
+
+variable "region" {
+  type        = string
+  description = "The region to deploy to"
+  default     = "eu-west-1"
+  nullable    = false
+
+  validation {
+    condition     = can(regex("^eu-", var.region))
+    error_message = "The region must be in the EU."
+  }
+}
+
+variable "tags" {
+  default = {
+    team = "platform"
+  }
+}
+
+`
+	assert.Equal(t, expected, readTarget(t, tf, "terraplate.tf"))
+}
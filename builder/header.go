@@ -0,0 +1,187 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/verifa/terraplate/parser"
+)
+
+// commentSyntax defines how to write comments in a type of file. Either each
+// line is prefixed, such as with #, or the lines are wrapped, such as with
+// <!-- and -->
+type commentSyntax struct {
+	line  string
+	start string
+	end   string
+}
+
+var (
+	hashComment  = &commentSyntax{line: "#"}
+	slashComment = &commentSyntax{line: "//"}
+	xmlComment   = &commentSyntax{start: "<!--", end: "-->"}
+)
+
+// commentSyntaxes contains the comment syntax for file extensions, where nil
+// means that the files do not support comments
+var commentSyntaxes = map[string]*commentSyntax{
+	".tf":     hashComment,
+	".tfvars": hashComment,
+	".hcl":    hashComment,
+	".yaml":   hashComment,
+	".yml":    hashComment,
+	".toml":   hashComment,
+	".sh":     hashComment,
+	".py":     hashComment,
+	".go":     slashComment,
+	".js":     slashComment,
+	".ts":     slashComment,
+	".md":     xmlComment,
+	".html":   xmlComment,
+	".xml":    xmlComment,
+	".json":   nil,
+}
+
+// targetCommentSyntax returns the comment syntax for the target file, or nil
+// if the file does not support comments.
+// It is not known whether files with other extensions support comments, so
+// they only use # comments if the header was set explicitly
+func targetCommentSyntax(target string, explicit bool) *commentSyntax {
+	syntax, ok := commentSyntaxes[strings.ToLower(filepath.Ext(target))]
+	if !ok {
+		if explicit {
+			return hashComment
+		}
+		return nil
+	}
+	return syntax
+}
+
+// comment returns the text as a comment, followed by an empty line
+func (c *commentSyntax) comment(text string) string {
+	var b strings.Builder
+	if c.line != "" {
+		for _, line := range strings.Split(text, "\n") {
+			if line == "" {
+				b.WriteString(c.line + "\n")
+				continue
+			}
+			b.WriteString(c.line + " " + line + "\n")
+		}
+	} else {
+		b.WriteString(c.start + "\n" + strings.Trim(text, "\n") + "\n" + c.end + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// leadingComment returns the text of the comment at the start of the
+// contents, without the comment syntax and trailing spaces, and whether the
+// contents start with a comment. The comment ends at the first line that is
+// not a comment, which is the empty line after a header
+func (c *commentSyntax) leadingComment(contents string) (string, bool) {
+	var (
+		lines    = strings.Split(contents, "\n")
+		comments []string
+	)
+	if c.line != "" {
+		for _, line := range lines {
+			if !strings.HasPrefix(line, c.line) {
+				break
+			}
+			line = strings.TrimPrefix(strings.TrimPrefix(line, c.line), " ")
+			comments = append(comments, strings.TrimRight(line, " \t\r"))
+		}
+		return strings.Join(comments, "\n"), len(comments) > 0
+	}
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \t\r") != c.start {
+		return "", false
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, " \t\r")
+		if line == c.end {
+			return strings.Join(comments, "\n"), true
+		}
+		comments = append(comments, line)
+	}
+	return "", false
+}
+
+// trimLines returns the text without trailing spaces on each line, as they
+// can be removed when formatting
+func trimLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// headerText returns the text of the header for a generated file, or an empty
+// string if the header is disabled, and whether the header was set explicitly
+// rather than being the default.
+// A header set on the template takes precedence over the build{} block. The
+// template is nil for the terraplate.tf file
+func headerText(tf *parser.Terrafile, tmpl *parser.TerraTemplate, data *parser.BuildData) (string, bool, error) {
+	var header *string
+	if tf.BuildBlock != nil {
+		header = tf.BuildBlock.Header
+	}
+	if tmpl != nil && tmpl.Header != nil {
+		header = tmpl.Header
+	}
+	if header == nil {
+		text := "\nNOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE\n\nTerrafile: " + tf.RelativePath()
+		if tmpl != nil {
+			text += "\nTemplate: " + tmpl.Name
+		}
+		return text, false, nil
+	}
+	if *header == "" {
+		return "", true, nil
+	}
+	contents, execErr := parser.ExecTemplate(data, "header", *header)
+	if execErr != nil {
+		return "", true, fmt.Errorf("templating header: %w", execErr)
+	}
+	return strings.TrimRight(contents.String(), "\n"), true, nil
+}
+
+// addHeader adds the header to the contents of the target file as a comment,
+// and returns whether the header was added.
+// JSON does not support comments, so the header is only added to JSON objects
+// as a key if the build{} block sets json_header_key
+func addHeader(tf *parser.Terrafile, target string, header string, explicit bool, contents []byte) ([]byte, bool) {
+	if header == "" {
+		return contents, false
+	}
+	if syntax := targetCommentSyntax(target, explicit); syntax != nil {
+		return append([]byte(syntax.comment(header)), contents...), true
+	}
+	if strings.EqualFold(filepath.Ext(target), ".json") && tf.BuildBlock != nil && tf.BuildBlock.JSONHeaderKey != "" {
+		return embedJSONHeader(tf.BuildBlock.JSONHeaderKey, header, contents)
+	}
+	return contents, false
+}
+
+// embedJSONHeader adds the header as the first key of a JSON object. Contents
+// that are not a JSON object are returned as they are, so that invalid JSON is
+// reported when the file is validated
+func embedJSONHeader(key string, header string, contents []byte) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(contents)
+	if !bytes.HasPrefix(trimmed, []byte("{")) || !json.Valid(trimmed) {
+		return contents, false
+	}
+	// Marshalling strings cannot fail
+	keyJSON, _ := json.Marshal(key)
+	headerJSON, _ := json.Marshal(strings.TrimSpace(header))
+	rest := bytes.TrimSpace(trimmed[1:])
+	separator := ","
+	if bytes.Equal(rest, []byte("}")) {
+		separator = ""
+	}
+	return []byte(fmt.Sprintf("{%s: %s%s %s", keyJSON, headerJSON, separator, rest)), true
+}
@@ -0,0 +1,166 @@
+package builder
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetCommentSyntax(t *testing.T) {
+	tests := map[string]struct {
+		target   string
+		explicit bool
+		expected string
+	}{
+		"hash": {
+			target:   "main.tp.tf",
+			expected: "# first\n#\n# second\n\n",
+		},
+		"slash": {
+			target:   "main.go",
+			expected: "// first\n//\n// second\n\n",
+		},
+		"xml": {
+			target:   "README.MD",
+			expected: "<!--\nfirst\n\nsecond\n-->\n\n",
+		},
+		"json": {
+			target:   "config.json",
+			explicit: true,
+		},
+		"unknown extension": {
+			target: "run.cmd",
+		},
+		"unknown extension with explicit header": {
+			target:   "run.cmd",
+			explicit: true,
+			expected: "# first\n#\n# second\n\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			syntax := targetCommentSyntax(tc.target, tc.explicit)
+			if tc.expected == "" {
+				assert.Nil(t, syntax)
+				return
+			}
+			require.NotNil(t, syntax)
+			assert.Equal(t, tc.expected, syntax.comment("first\n\nsecond"))
+		})
+	}
+}
+
+func TestEmbedJSONHeader(t *testing.T) {
+	tests := map[string]struct {
+		contents string
+		expected string
+		added    bool
+	}{
+		"object": {
+			contents: "{\"a\": 1}",
+			expected: "{\"_comment\": \"Managed by Terraplate\", \"a\": 1}",
+			added:    true,
+		},
+		"empty object": {
+			contents: "{}",
+			expected: "{\"_comment\": \"Managed by Terraplate\" }",
+			added:    true,
+		},
+		"array": {
+			contents: "[1, 2]",
+			expected: "[1, 2]",
+		},
+		"invalid": {
+			contents: "{\"a\": }",
+			expected: "{\"a\": }",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			contents, added := embedJSONHeader("_comment", "Managed by Terraplate\n", []byte(tc.contents))
+			assert.Equal(t, tc.expected, string(contents))
+			assert.Equal(t, tc.added, added)
+		})
+	}
+}
+
+func TestBuildHeader(t *testing.T) {
+	tf := testTerrafile(t, map[string]string{
+		"terraplate.hcl": `
+build {
+  header          = "Managed by the {{ .Values.team }} team"
+  json_header_key = "_comment"
+}
+
+values {
+  team = "platform"
+}
+
+template "main" {
+  contents = "locals {}\n"
+  target   = "main.tp.tf"
+}
+
+template "override" {
+  contents = "locals {}\n"
+  target   = "override.tp.tf"
+  header   = "Template {{ .Values.team }}"
+}
+
+template "disabled" {
+  contents = "locals {}\n"
+  target   = "disabled.tp.tf"
+  header   = ""
+}
+
+template "json" {
+  contents = "{\"a\": 1}\n"
+  target   = "config.json"
+}
+
+template "script" {
+  contents = "echo hello\n"
+  target   = "run.cmd"
+}
+`,
+	})
+	require.NoError(t, BuildTerrafile(tf, io.Discard))
+
+	assert.Equal(t, "# Managed by the platform team\n\nlocals {}\n", readTarget(t, tf, "main.tp.tf"))
+	assert.Equal(t, "# Template platform\n\nlocals {}\n", readTarget(t, tf, "override.tp.tf"))
+	assert.Equal(t, "locals {}\n", readTarget(t, tf, "disabled.tp.tf"))
+	assert.JSONEq(t, `{"_comment": "Managed by the platform team", "a": 1}`, readTarget(t, tf, "config.json"))
+	// The header was set explicitly, so files with unknown extensions get it
+	assert.Equal(t, "# Managed by the platform team\n\necho hello\n", readTarget(t, tf, "run.cmd"))
+	assert.Contains(t, readTarget(t, tf, "terraplate.tf"), "# Managed by the platform team\n")
+}
+
+func TestBuildDefaultHeader(t *testing.T) {
+	tf := testTerrafile(t, map[string]string{
+		"terraplate.hcl": `
+template "main" {
+  contents = "locals {}\n"
+  target   = "main.tp.tf"
+}
+
+template "json" {
+  contents = "{\"a\": 1}\n"
+  target   = "config.json"
+}
+
+template "script" {
+  contents = "echo hello\n"
+  target   = "run.cmd"
+}
+`,
+	})
+	require.NoError(t, BuildTerrafile(tf, io.Discard))
+
+	expected := "#\n# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE\n#\n# Terrafile: terraplate.hcl\n# Template: main\n\nlocals {}\n"
+	assert.Equal(t, expected, readTarget(t, tf, "main.tp.tf"))
+	// Files that may not support comments do not get the default header
+	assert.JSONEq(t, `{"a": 1}`, readTarget(t, tf, "config.json"))
+	assert.Equal(t, "echo hello\n", readTarget(t, tf, "run.cmd"))
+}
@@ -0,0 +1,215 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/verifa/terraplate/parser"
+)
+
+const (
+	manifestDir  = ".terraplate"
+	manifestFile = "manifest.json"
+)
+
+// buildManifest contains the files generated for a root module, so that files
+// which are no longer generated can be deleted by the next build
+type buildManifest struct {
+	Files []*manifestEntry `json:"files"`
+	// MockOutputs contains the dependencies whose mock outputs were used by the
+	// build and are not allowed when applying
+	MockOutputs []string `json:"mock_outputs,omitempty"`
+}
+
+// manifestEntry is a file generated for a root module
+type manifestEntry struct {
+	// Path is the path of the file relative to the Terrafile
+	Path string `json:"path"`
+	// Header is the text of the header written to the file, which is used to
+	// check that the file was generated by Terraplate before deleting it
+	Header string `json:"header,omitempty"`
+}
+
+func manifestPath(tf *parser.Terrafile) string {
+	return filepath.Join(tf.Dir, manifestDir, manifestFile)
+}
+
+// readManifest reads the manifest of the previous build, or returns an empty
+// manifest if the root module has not been built before
+func readManifest(tf *parser.Terrafile) (*buildManifest, error) {
+	path := manifestPath(tf)
+	contents, readErr := os.ReadFile(path)
+	if readErr != nil {
+		if errors.Is(readErr, os.ErrNotExist) {
+			return &buildManifest{}, nil
+		}
+		return nil, fmt.Errorf("reading manifest %s: %w", path, readErr)
+	}
+	var manifest buildManifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// MockedDependencies returns the dependencies whose mock outputs were used by
+// the last build of the root module and are not allowed when applying, as
+// applying would use the mock values
+func MockedDependencies(tf *parser.Terrafile) ([]string, error) {
+	manifest, err := readManifest(tf)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.MockOutputs, nil
+}
+
+// add adds a generated file to the manifest
+func (m *buildManifest) add(tf *parser.Terrafile, path string, header string) error {
+	relPath, relErr := filepath.Rel(tf.Dir, path)
+	if relErr != nil {
+		return fmt.Errorf("getting path of %s relative to %s: %w", path, tf.Dir, relErr)
+	}
+	relPath = filepath.ToSlash(relPath)
+	// A later template can overwrite the file of an earlier one
+	for _, file := range m.Files {
+		if file.Path == relPath {
+			file.Header = header
+			return nil
+		}
+	}
+	m.Files = append(m.Files, &manifestEntry{
+		Path:   relPath,
+		Header: header,
+	})
+	return nil
+}
+
+func (m *buildManifest) contains(path string) bool {
+	for _, file := range m.Files {
+		if file.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the manifest to the .terraplate directory of the root module,
+// sorted by path to avoid changes between builds
+func (m *buildManifest) write(tf *parser.Terrafile) error {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+	contents, marshalErr := json.MarshalIndent(m, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("encoding manifest: %w", marshalErr)
+	}
+	path := manifestPath(tf)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("creating directory for manifest %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(contents, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing manifest %s: %w", path, err)
+	}
+	return nil
+}
+
+// deleteStaleFiles deletes the files of the previous build that are no longer
+// generated, e.g. because a template was removed or its condition is false.
+// Files that do not have the header they were generated with are not deleted,
+// as they may have been edited or not have been generated by Terraplate
+func deleteStaleFiles(tf *parser.Terrafile, previous *buildManifest, current *buildManifest, out io.Writer) error {
+	for _, file := range previous.Files {
+		if current.contains(file.Path) {
+			continue
+		}
+		path, pathErr := file.targetPath(tf)
+		if pathErr != nil {
+			return pathErr
+		}
+		contents, readErr := os.ReadFile(path)
+		if readErr != nil {
+			if errors.Is(readErr, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("reading stale file %s: %w", path, readErr)
+		}
+		if !hasHeader(path, contents, file.Header) {
+			fmt.Fprintf(out, "Not deleting %s: it is no longer generated but does not have the Terraplate header\n", path)
+			continue
+		}
+		fmt.Fprintf(out, "Deleting %s: it is no longer generated\n", path)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("deleting stale file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// targetPath returns the path of the generated file. Files are only deleted
+// within the Terrafile tree, in case the manifest was edited
+func (e *manifestEntry) targetPath(tf *parser.Terrafile) (string, error) {
+	if filepath.IsAbs(filepath.FromSlash(e.Path)) {
+		return "", fmt.Errorf("manifest %s contains the absolute path %s", manifestPath(tf), e.Path)
+	}
+	path := filepath.Join(tf.Dir, filepath.FromSlash(e.Path))
+	absPath, absErr := filepath.Abs(path)
+	if absErr != nil {
+		return "", fmt.Errorf("getting absolute path for %s: %w", path, absErr)
+	}
+	relPath, relErr := filepath.Rel(tf.RootDir(), absPath)
+	if relErr != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("manifest %s contains the path %s, which is outside of the Terrafile tree %s", manifestPath(tf), e.Path, tf.RootDir())
+	}
+	return path, nil
+}
+
+// hasHeader returns true if the contents of the target file start with the
+// header, written with the comment syntax of the target. JSON files have the
+// header if it is the value of the first key. Contents without a header never
+// have one
+func hasHeader(target string, contents []byte, header string) bool {
+	if strings.TrimSpace(header) == "" {
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(target), ".json") {
+		value, ok := firstJSONValue(contents)
+		return ok && value == strings.TrimSpace(header)
+	}
+	// The header was written, so files with other extensions use # comments
+	syntax := targetCommentSyntax(target, true)
+	if syntax == nil {
+		return false
+	}
+	expected := trimLines(header)
+	if syntax.line == "" {
+		// Wrapped comments do not start or end with empty lines
+		expected = strings.Trim(expected, "\n")
+	}
+	comment, ok := syntax.leadingComment(string(contents))
+	return ok && comment == expected
+}
+
+// firstJSONValue returns the value of the first key of a JSON object, if it is
+// a string
+func firstJSONValue(contents []byte) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return "", false
+	}
+	if _, err := decoder.Token(); err != nil {
+		return "", false
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return "", false
+	}
+	value, ok := token.(string)
+	return value, ok
+}
@@ -0,0 +1,198 @@
+package builder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestTerrafile returns a Terrafile with a template that is only built if
+// enabled is true, and a template that is removed if removed is true
+func manifestTerrafile(enabled bool, removed bool) string {
+	contents := `
+values {
+  enabled = ` + strconv.FormatBool(enabled) + `
+}
+
+template "main" {
+  contents = "locals {}\n"
+  target   = "main.tp.tf"
+}
+
+template "optional" {
+  contents  = "locals {}\n"
+  target    = "optional.tp.tf"
+  condition = "{{ .Values.enabled }}"
+}
+`
+	if !removed {
+		contents += `
+template "readme" {
+  contents = "# Readme\n"
+  target   = "README.md"
+}
+`
+	}
+	return contents
+}
+
+func fileExists(t *testing.T, path string) bool {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func TestDeleteStaleFiles(t *testing.T) {
+	tests := map[string]struct {
+		// edit changes the files of the root module after the first build
+		edit func(t *testing.T, dir string)
+		// deleted and kept are the targets expected to be deleted and kept
+		// by the second build
+		deleted []string
+		kept    []string
+		err     string
+	}{
+		"nothing changed": {
+			edit: func(t *testing.T, dir string) {},
+			kept: []string{"main.tp.tf", "optional.tp.tf", "README.md"},
+		},
+		"template removed": {
+			edit: func(t *testing.T, dir string) {
+				writeFiles(t, dir, map[string]string{"terraplate.hcl": manifestTerrafile(true, true)})
+			},
+			deleted: []string{"README.md"},
+			kept:    []string{"main.tp.tf", "optional.tp.tf"},
+		},
+		"condition became false": {
+			edit: func(t *testing.T, dir string) {
+				writeFiles(t, dir, map[string]string{"terraplate.hcl": manifestTerrafile(false, false)})
+			},
+			deleted: []string{"optional.tp.tf"},
+			kept:    []string{"main.tp.tf", "README.md"},
+		},
+		"header stripped": {
+			edit: func(t *testing.T, dir string) {
+				writeFiles(t, dir, map[string]string{
+					"terraplate.hcl": manifestTerrafile(false, true),
+					// The header text is still in the file, but not at the start
+					"optional.tp.tf": "locals {}\n\n# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE\n# Terrafile: terraplate.hcl\n# Template: optional\n",
+				})
+			},
+			deleted: []string{"README.md"},
+			kept:    []string{"main.tp.tf", "optional.tp.tf"},
+		},
+		"missing manifest": {
+			edit: func(t *testing.T, dir string) {
+				writeFiles(t, dir, map[string]string{"terraplate.hcl": manifestTerrafile(false, true)})
+				require.NoError(t, os.RemoveAll(filepath.Join(dir, manifestDir)))
+			},
+			kept: []string{"main.tp.tf", "optional.tp.tf", "README.md"},
+		},
+		"path outside the Terrafile tree": {
+			edit: func(t *testing.T, dir string) {
+				writeFiles(t, dir, map[string]string{
+					manifestDir + "/" + manifestFile: `{"files": [{"path": "../../x.tf", "header": "header"}]}`,
+				})
+			},
+			err: "outside of the Terrafile tree",
+		},
+		"absolute path": {
+			edit: func(t *testing.T, dir string) {
+				writeFiles(t, dir, map[string]string{
+					manifestDir + "/" + manifestFile: `{"files": [{"path": "` + filepath.ToSlash(filepath.Join(dir, "main.tp.tf")) + `", "header": "header"}]}`,
+				})
+			},
+			err: "contains the absolute path",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tf := testTerrafile(t, map[string]string{"terraplate.hcl": manifestTerrafile(true, false)})
+			require.NoError(t, BuildTerrafile(tf, io.Discard))
+			for _, target := range []string{"main.tp.tf", "optional.tp.tf", "README.md"} {
+				require.True(t, fileExists(t, filepath.Join(tf.Dir, target)), "target %s was not built", target)
+			}
+
+			tc.edit(t, tf.Dir)
+			err := BuildTerrafile(parseRootModule(t, tf.Dir), io.Discard)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			for _, target := range tc.deleted {
+				assert.False(t, fileExists(t, filepath.Join(tf.Dir, target)), "target %s was not deleted", target)
+			}
+			for _, target := range tc.kept {
+				assert.True(t, fileExists(t, filepath.Join(tf.Dir, target)), "target %s was deleted", target)
+			}
+		})
+	}
+}
+
+func TestHasHeader(t *testing.T) {
+	tests := map[string]struct {
+		target   string
+		contents string
+		header   string
+		expected bool
+	}{
+		"hash": {
+			target:   "main.tp.tf",
+			contents: "#\n# Generated\n#\n# By Terraplate\n\nlocals {}\n",
+			header:   "\nGenerated\n\nBy Terraplate",
+			expected: true,
+		},
+		"xml": {
+			target:   "README.md",
+			contents: "<!--\nGenerated\n-->\n\n# Readme\n",
+			header:   "\nGenerated",
+			expected: true,
+		},
+		"json": {
+			target:   "config.json",
+			contents: "{\n  \"_comment\": \"Generated\",\n  \"a\": 1\n}\n",
+			header:   "Generated",
+			expected: true,
+		},
+		"unknown extension": {
+			target:   "run.cmd",
+			contents: "# Generated\n\necho hello\n",
+			header:   "Generated",
+			expected: true,
+		},
+		"not at the start": {
+			target:   "main.tp.tf",
+			contents: "locals {}\n\n# Generated\n",
+			header:   "Generated",
+		},
+		"edited": {
+			target:   "main.tp.tf",
+			contents: "# Generated by someone\n\nlocals {}\n",
+			header:   "Generated",
+		},
+		"json not the first key": {
+			target:   "config.json",
+			contents: "{\"a\": \"b\", \"_comment\": \"Generated\"}",
+			header:   "Generated",
+		},
+		"no header": {
+			target:   "main.tp.tf",
+			contents: "locals {}\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, hasHeader(tc.target, []byte(tc.contents), tc.header))
+		})
+	}
+}
@@ -35,7 +35,7 @@ var applyCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("parsing terraplate: %w", err)
 		}
-		r := runner.Run(config, runner.RunApply(), runner.Jobs(applyJobs), runner.ExtraArgs(args))
+		r := runner.Run(config, runner.RunApply(), runner.Jobs(applyJobs), runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 
 		// Print log
 		fmt.Println(r.Log(runner.OutputLevelAll))
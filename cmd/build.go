@@ -32,7 +32,11 @@ var buildCmd = &cobra.Command{
 	Long: `Build (or generate) the Terraform files.
 	
 For each Terrafile that is detected, build the Terraform files using the
-templates and configurations detected.`,
+templates and configurations detected.
+
+The files generated for each root module are listed in
+.terraplate/manifest.json, and files from a previous build that are no longer
+generated are deleted, unless they do not have the Terraplate header.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config, err := parser.Parse(&config.ParserConfig)
 		if err != nil {
@@ -45,7 +49,7 @@ templates and configurations detected.`,
 		if doValidate {
 			runOpts = append(runOpts, runner.RunValidate())
 		}
-		runOpts = append(runOpts, runner.ExtraArgs(args))
+		runOpts = append(runOpts, runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 		r := runner.Run(config, runOpts...)
 
 		fmt.Println(r.Log(runner.OutputLevelAll))
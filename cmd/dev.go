@@ -50,7 +50,7 @@ var devCmd = &cobra.Command{
 			// This does not discard the Terraform output.
 			runner.Output(io.Discard),
 		}
-		runOpts = append(runOpts, runner.ExtraArgs(args))
+		runOpts = append(runOpts, runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 		runner := runner.New(config, runOpts...)
 
 		p := tea.NewProgram(
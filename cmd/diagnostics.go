@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/v2"
+)
+
+// diagnosticsWidth is the width used to wrap the text of diagnostics
+const diagnosticsWidth = 78
+
+// printError pretty prints an error. If the error contains HCL diagnostics, they
+// are printed with a snippet of the source that caused them
+func printError(out io.Writer, err error) {
+	var (
+		errs     = []error{err}
+		multiErr *multierror.Error
+	)
+	if errors.As(err, &multiErr) {
+		errs = multiErr.Errors
+	}
+	for _, err := range errs {
+		var diags hcl.Diagnostics
+		if errors.As(err, &diags) {
+			printDiagnostics(out, diags)
+			continue
+		}
+		fmt.Fprintf(out, "\n%s %s\n", errorColor.Sprint("Error:"), err.Error())
+	}
+}
+
+func printDiagnostics(out io.Writer, diags hcl.Diagnostics) {
+	// The diagnostic writer needs the source files to print the snippets
+	var files = make(map[string]*hcl.File)
+	for _, diag := range diags {
+		if diag.Subject == nil {
+			continue
+		}
+		if _, ok := files[diag.Subject.Filename]; ok {
+			continue
+		}
+		src, readErr := os.ReadFile(diag.Subject.Filename)
+		if readErr != nil {
+			// Without the source the diagnostic is still printed, just without
+			// a snippet
+			continue
+		}
+		files[diag.Subject.Filename] = &hcl.File{Bytes: src}
+	}
+	fmt.Fprintln(out)
+	diagWriter := hcl.NewDiagnosticTextWriter(out, files, diagnosticsWidth, !color.NoColor)
+	if err := diagWriter.WriteDiagnostics(diags); err != nil {
+		fmt.Fprintf(out, "\n%s %s\n", errorColor.Sprint("Error:"), diags.Error())
+	}
+}
@@ -66,7 +66,7 @@ var driftCmd = &cobra.Command{
 			runner.RunShowPlan(),
 			runner.Jobs(planJobs),
 		}
-		runOpts = append(runOpts, runner.ExtraArgs(args))
+		runOpts = append(runOpts, runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 		r := runner.Run(config, runOpts...)
 
 		if notifyService != nil {
@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 Verifa <info@verifa.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/verifa/terraplate/parser"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain [dir]",
+	Short: "Explain where the configuration of root modules comes from",
+	Long: `Explain where the configuration of root modules comes from.
+
+For each root module in the given directory (defaults to the working directory),
+print every effective setting alongside the file that defined it and the files
+that it overrides.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parserConfig := config.ParserConfig
+		if len(args) > 0 {
+			parserConfig.Chdir = args[0]
+			if !filepath.IsAbs(args[0]) {
+				parserConfig.Chdir = filepath.Join(config.ParserConfig.Chdir, args[0])
+			}
+		}
+		config, err := parser.Parse(&parserConfig)
+		if err != nil {
+			return fmt.Errorf("parsing terraplate: %w", err)
+		}
+		for _, tf := range config.RootModules() {
+			fmt.Println(boldText.Sprint("Root Module: ", tf.Path))
+			for _, key := range tf.OriginKeys() {
+				origins := tf.Origins(key)
+				if value, ok := explainValue(tf, key); ok {
+					fmt.Printf("  %s = %s\n", key, value)
+				} else {
+					fmt.Printf("  %s\n", key)
+				}
+				fmt.Printf("    defined in %s\n", explainRange(origins[0].Range))
+				for _, origin := range origins[1:] {
+					fmt.Printf("    overrides %s\n", explainRange(origin.Range))
+				}
+			}
+			fmt.Println("")
+		}
+		return nil
+	},
+}
+
+// explainValue returns the effective value for a setting, if it has been
+// evaluated
+func explainValue(tf *parser.Terrafile, key string) (string, bool) {
+	var (
+		values map[string]cty.Value
+		parts  = strings.SplitN(key, ".", 2)
+	)
+	switch parts[0] {
+	case "local":
+		values = tf.Locals()
+	case "var":
+		values = tf.Variables()
+	case "values":
+		values = tf.Values()
+	default:
+		return "", false
+	}
+	value, ok := values[parts[1]]
+	if !ok {
+		return "", false
+	}
+	return string(hclwrite.TokensForValue(value).Bytes()), true
+}
+
+// explainRange returns a range as a string, with the filename relative to the
+// current directory if possible
+func explainRange(rng hcl.Range) string {
+	if wd, wdErr := os.Getwd(); wdErr == nil {
+		if absPath, absErr := filepath.Abs(rng.Filename); absErr == nil {
+			if relPath, relErr := filepath.Rel(wd, absPath); relErr == nil {
+				rng.Filename = relPath
+			}
+		}
+	}
+	return rng.String()
+}
+
+func init() {
+	RootCmd.AddCommand(explainCmd)
+}
@@ -52,7 +52,7 @@ var initCmd = &cobra.Command{
 			runOpts = append(runOpts, runner.RunInitUpgrade())
 		}
 
-		runOpts = append(runOpts, runner.ExtraArgs(args))
+		runOpts = append(runOpts, runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 		r := runner.Run(config, runOpts...)
 		fmt.Println(r.Log(runner.OutputLevelAll))
 		fmt.Println(r.Summary(runner.OutputLevelAll))
@@ -44,16 +44,26 @@ the build command, for example.`,
 			}
 			fmt.Println("Templates:")
 			for _, tmpl := range tf.Templates {
-				condition, condErr := tmpl.Condition(data)
-				if condErr != nil {
-					return fmt.Errorf("evaluating condition for template \"%s\" in %s: %w", tmpl.Name, tf.Path, condErr)
+				if !tmpl.IsEnabled() {
+					continue
 				}
-				if condition {
-					fmt.Printf(" - %s --> %s\n", tmpl.Name, tmpl.Target)
+				for _, eachData := range tmpl.EachData(data) {
+					condition, condErr := tmpl.Condition(eachData)
+					if condErr != nil {
+						return condErr
+					}
+					if !condition {
+						continue
+					}
+					target, targetErr := tmpl.TargetPath(eachData)
+					if targetErr != nil {
+						return targetErr
+					}
+					fmt.Printf(" - %s --> %s\n", tmpl.Name, target)
 				}
 			}
 			fmt.Println("Variables:")
-			for name := range tf.Variables() {
+			for _, name := range tf.VariableNames() {
 				fmt.Println(" -", name)
 			}
 			fmt.Println("Locals:")
@@ -63,7 +63,7 @@ var planCmd = &cobra.Command{
 		if runInit {
 			runOpts = append(runOpts, runner.RunInit())
 		}
-		runOpts = append(runOpts, runner.ExtraArgs(args))
+		runOpts = append(runOpts, runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 		r := runner.Run(config, runOpts...)
 
 		if planDevMode {
@@ -77,6 +77,7 @@ var planCmd = &cobra.Command{
 				// Discard any output from the runner itself.
 				// This does not discard the Terraform output.
 				runner.Output(io.Discard),
+				runner.TerraformBinary(terraformBinary),
 			}
 			// Override options in runner
 			r.Opts = runner.NewOpts(runOpts...)
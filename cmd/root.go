@@ -16,7 +16,6 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -27,7 +26,11 @@ type cmdConfig struct {
 	ParserConfig parser.Config
 }
 
-var config cmdConfig
+var (
+	config cmdConfig
+	// terraformBinary overrides the terraform binary to run
+	terraformBinary string
+)
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -49,11 +52,13 @@ func Execute() {
 	err := RootCmd.Execute()
 	if err != nil {
 		// Pretty print the error before finishing
-		fmt.Printf("\n%s %s\n", errorColor.Sprint("Error:"), err.Error())
+		printError(os.Stdout, err)
 		os.Exit(1)
 	}
 }
 
 func init() {
 	RootCmd.PersistentFlags().StringVarP(&config.ParserConfig.Chdir, "chdir", "C", ".", "Switch to a different working directory before executing the given subcommand.")
+	RootCmd.PersistentFlags().StringVar(&terraformBinary, "terraform-binary", "", "Terraform binary to run, e.g. tofu for OpenTofu. Overrides the binary from the exec block in Terrafiles (default \"terraform\")")
+	RootCmd.PersistentFlags().StringSliceVar(&config.ParserConfig.Exclude, "exclude", nil, "Exclude files and directories matching the given patterns (gitignore syntax) when looking for Terrafiles.")
 }
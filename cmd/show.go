@@ -58,7 +58,7 @@ var showCmd = &cobra.Command{
 			runOpts = append(runOpts, runner.Output(io.Discard))
 		}
 
-		runOpts = append(runOpts, runner.ExtraArgs(args))
+		runOpts = append(runOpts, runner.ExtraArgs(args), runner.TerraformBinary(terraformBinary))
 		r := runner.Run(config, runOpts...)
 
 		fmt.Println(r.Log(outputLevel))
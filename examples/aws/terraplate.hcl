@@ -1,8 +1,4 @@
 
-template "backend" {
-  contents = read_template("backend.tmpl")
-}
-
 template "providers" {
   contents = read_template("providers.tmpl")
 }
@@ -16,6 +12,14 @@ variables {
   project     = "terraplate-aws-example"
 }
 
+backend "s3" {
+  bucket  = "bucket-name"
+  region  = var.aws_region
+  encrypt = true
+  # Generate a unique key for the state of each root module
+  key_pattern = "{{ .RelativeDir }}/terraform.tfstate"
+}
+
 exec {
   # Requires AWS auth to run, so skip running Terraform
   skip = true
@@ -0,0 +1,8 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: terraplate.hcl
+# Template: embedded
+
+# Content here will be templated
+# Built from terraplate.hcl
@@ -0,0 +1,8 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: terraplate.hcl
+# Template: example
+
+
+# Contents should be templated
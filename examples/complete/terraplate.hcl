@@ -1,4 +1,8 @@
 
+# Explicitly declare whether this Terrafile is a root module. By default, only
+# Terrafiles without child Terrafiles are root modules
+root_module = true
+
 # Define a template that reads from a file
 template "example" {
   contents = read_template("example.tmpl")
@@ -11,9 +15,16 @@ template "example" {
 template "embedded" {
   contents = <<-EOL
     # Content here will be templated
+    {{ template "comment" . }}
   EOL
 }
 
+# Define a partial, which any template can use with {{ template "comment" . }}.
+# Partials are inherited and can be overridden like templates
+partial "comment" {
+  contents = "# Built from {{ .RelativePath }}"
+}
+
 # Define terraform locals that can be used for templating and are written to the
 # terraplate.tf file
 locals {
@@ -32,10 +43,57 @@ variables {
   key = "value"
 }
 
+# Define terraform variables with a type, description, validation, etc. that are
+# written to the terraplate.tf file
+variable "environment" {
+  type        = string
+  description = "The environment"
+  default     = "dev"
+  sensitive   = false
+  nullable    = false
+
+  validation {
+    condition     = length(var.environment) > 0
+    error_message = "The environment must not be empty."
+  }
+}
+
 # Define values that can be used for templating but are *not* written to any
 # terraform files
 values {
   key = "value"
+  # Expressions can reference locals (local.*), variables (var.*) and values
+  # (values.*), including those inherited from parent Terrafiles
+  key_ref = "${values.key}-${local.key}"
+}
+
+# Define how locals, variables or values are merged with those inherited from
+# parent Terrafiles
+merge "values" {
+  # Either "replace" (default) or "deep" to merge objects and maps recursively
+  strategy = "replace"
+  # How to merge lists when deep merging: either "replace" (default) or "append"
+  lists = "replace"
+  # Optionally limit the strategy to some keys only
+  keys = []
+}
+
+# Define providers which are built into the terraplate.tf file. Providers are
+# inherited and matched by name and alias
+provider "local" {}
+
+# Use for_each to create an aliased provider for each element of a map or list
+provider "local" {
+  for_each = ["a", "b"]
+  alias    = each.key
+}
+
+# Define the terraform backend of any type, which is built into the terraform
+# block in the terraplate.tf file
+backend "local" {
+  # Generate the key (or equivalent, e.g. path for the local backend) of the
+  # state for each root module using a Go template
+  key_pattern = "{{ .RelativeDir }}/terraform.tfstate"
 }
 
 # Define an exec block configuring how terraform is executed from terraplate
@@ -43,8 +101,16 @@ exec {
   # Whether to skip running terraform. This is useful for disabling some root
   # modules but wanting to keep them in Git
   skip = false
+  # The terraform binary to run, e.g. tofu for OpenTofu. Can be overridden with
+  # the --terraform-binary flag
+  binary = "terraform"
   # Extra args arbitrary strings passed to terraform for each invocation
   extra_args = []
+  # Environment variables set for each invocation of terraform. They are merged
+  # with those inherited from parent Terrafiles and can reference values
+  env = {
+    TF_VAR_key = values.key
+  }
 
   # Plan controls the behaviour for running terraform plan, and subsequntly
   # affects some of the terraform apply commands
@@ -0,0 +1,58 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: terraplate.hcl
+
+terraform {
+  required_version = ">= 1.1.0"
+
+  required_providers {
+    local = {
+      source  = "hashicorp/local"
+      version = "2.1.0"
+    }
+  }
+
+  backend "local" {
+    path = "./terraform.tfstate"
+  }
+}
+
+provider "local" {
+}
+
+provider "local" {
+  alias = "a"
+}
+
+provider "local" {
+  alias = "b"
+}
+
+locals {
+  key = "value"
+  other = {
+    msg = "can also be an object"
+    nested = {
+      list = ["and an object", "with a list"]
+    }
+  }
+}
+
+variable "environment" {
+  type        = string
+  description = "The environment"
+  default     = "dev"
+  sensitive   = false
+  nullable    = false
+
+  validation {
+    condition     = length(var.environment) > 0
+    error_message = "The environment must not be empty."
+  }
+}
+
+variable "key" {
+  default = "value"
+}
+
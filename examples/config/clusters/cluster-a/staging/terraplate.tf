@@ -0,0 +1,24 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: clusters/cluster-a/staging/terraplate.hcl
+
+terraform {
+  required_version = ">= 1.1.0"
+
+  required_providers {
+    local = {
+      source  = "hashicorp/local"
+      version = "2.1.0"
+    }
+  }
+}
+
+variable "cluster" {
+  default = "cluster-a"
+}
+
+variable "environment" {
+  default = "staging"
+}
+
@@ -0,0 +1,23 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: clusters/cluster-b/staging/terraplate.hcl
+# Template: cluster
+
+
+resource "local_file" "this" {
+  content  = jsonencode(local.cluster_config)
+  filename = "${path.module}/cluster.json"
+}
+
+# Now use these values to invoke something like the EKS module:
+# https://registry.terraform.io/modules/terraform-aws-modules/eks/aws/latest 
+# module "eks" {
+#   source  = "terraform-aws-modules/eks/aws"
+#   version = "18.2.3"
+
+#   cluster_name    = local.cluster_config.name
+#   cluster_version = local.cluster_config.version
+# 
+#   ... more inputs here ...
+# }
@@ -0,0 +1,12 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: eu-west-1/dev/file/terraplate.hcl
+# Template: backend
+
+
+terraform {
+  backend "local" {
+    path = "terraform.tfstate"
+  }
+}
@@ -0,0 +1,9 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: eu-west-1/dev/file/terraplate.hcl
+# Template: override
+
+locals {
+  region_level = true
+}
@@ -0,0 +1,10 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: eu-west-1/dev/file/terraplate.hcl
+# Template: providers
+
+
+provider "local" {
+  # Configuration options
+}
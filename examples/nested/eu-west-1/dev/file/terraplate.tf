@@ -0,0 +1,24 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: eu-west-1/dev/file/terraplate.hcl
+
+terraform {
+  required_version = ">= 1.1.0"
+
+  required_providers {
+    local = {
+      source  = "hashicorp/local"
+      version = "2.1.0"
+    }
+  }
+}
+
+variable "environment" {
+  default = "dev"
+}
+
+variable "region" {
+  default = "eu-west-1"
+}
+
@@ -0,0 +1,12 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: dev/terraplate.hcl
+# Template: backend
+
+
+terraform {
+  backend "local" {
+    path = "terraform.tfstate"
+  }
+}
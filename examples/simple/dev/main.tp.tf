@@ -0,0 +1,10 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: dev/terraplate.hcl
+# Template: main
+
+resource "local_file" "this" {
+  content  = "env = ${var.environment}"
+  filename = "${path.module}/env.txt"
+}
@@ -0,0 +1,20 @@
+#
+# NOTE: THIS FILE WAS AUTOMATICALLY GENERATED BY TERRAPLATE
+#
+# Terrafile: dev/terraplate.hcl
+
+terraform {
+  required_version = ">= 1.0.0"
+
+  required_providers {
+    local = {
+      source  = "hashicorp/local"
+      version = "2.1.0"
+    }
+  }
+}
+
+variable "environment" {
+  default = "dev"
+}
+
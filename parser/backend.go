@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// backendKeyAttributes contains the name of the attribute that identifies the
+// state for backends that do not use "key"
+var backendKeyAttributes = map[string]string{
+	"consul": "path",
+	"gcs":    "prefix",
+	"local":  "path",
+	"pg":     "schema_name",
+}
+
+// backendStoreAttributes contains the attributes that identify where backends
+// store their states, which together with the key identify the state of a
+// root module
+var backendStoreAttributes = map[string][]string{
+	"azurerm": {"storage_account_name", "container_name"},
+	"consul":  {"address"},
+	"gcs":     {"bucket"},
+	"local":   {},
+	"oss":     {"bucket", "prefix"},
+	"pg":      {"conn_str"},
+	"s3":      {"bucket"},
+}
+
+// TerraBackend defines the backend{} block within a Terrafile, which is built
+// into the terraform{} block of the terraplate.tf file.
+// Config contains the attributes to build, including the key generated from
+// the key pattern
+type TerraBackend struct {
+	// Type is the type of backend, e.g. s3, gcs or local
+	Type string `hcl:",label"`
+	// KeyPattern is a Go template that generates the key of the state for each
+	// root module, e.g. "{{ .RelativeDir }}/terraform.tfstate"
+	KeyPattern string `hcl:"key_pattern,optional"`
+	// KeyAttribute is the name of the attribute that the generated key is
+	// written to. Defaults to "key", or the equivalent for the backend type
+	KeyAttribute string         `hcl:"key_attribute,optional"`
+	Attributes   hcl.Attributes `hcl:",remain"`
+	// DeclRange is the range of the backend block in the Terrafile
+	DeclRange hcl.Range
+	Config    map[string]cty.Value
+}
+
+// keyAttribute returns the name of the attribute that identifies the state
+func (b *TerraBackend) keyAttribute() string {
+	if b.KeyAttribute != "" {
+		return b.KeyAttribute
+	}
+	if attr, ok := backendKeyAttributes[b.Type]; ok {
+		return attr
+	}
+	return "key"
+}
+
+// stateID returns what identifies the state of a root module in the given
+// directory: the key and the attributes that identify the store. Backends of
+// other types are identified by their whole configuration.
+// An empty string is returned if the key is not set, e.g. because it is given
+// with -backend-config when initialising
+func (b *TerraBackend) stateID(dir string) (string, error) {
+	config := b.Config
+	if storeAttrs, ok := backendStoreAttributes[b.Type]; ok {
+		key, hasKey := b.Config[b.keyAttribute()]
+		if b.Type == "local" {
+			// Relative paths are relative to the root module, which is also
+			// where the state is stored by default
+			path := "terraform.tfstate"
+			if hasKey && key.IsKnown() && !key.IsNull() && key.Type() == cty.String {
+				path = key.AsString()
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			absPath, absErr := filepath.Abs(path)
+			if absErr != nil {
+				return "", fmt.Errorf("getting absolute path for %s: %w", path, absErr)
+			}
+			key, hasKey = cty.StringVal(absPath), true
+		}
+		if !hasKey || !key.IsWhollyKnown() || key.IsNull() {
+			return "", nil
+		}
+		config = map[string]cty.Value{
+			b.keyAttribute(): key,
+		}
+		for _, name := range storeAttrs {
+			if value, ok := b.Config[name]; ok {
+				config[name] = value
+			}
+		}
+	}
+	value := cty.EmptyObjectVal
+	if len(config) > 0 {
+		value = cty.ObjectVal(config)
+	}
+	state, marshalErr := ctyjson.Marshal(value, value.Type())
+	if marshalErr != nil {
+		return "", marshalErr
+	}
+	return b.Type + ":" + string(state), nil
+}
+
+func (b *TerraBackend) validate() error {
+	if _, ok := b.Attributes[b.keyAttribute()]; ok && b.KeyPattern != "" {
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Conflicting backend key",
+				Detail:   fmt.Sprintf("Backend \"%s\" cannot define both key_pattern and %s.", b.Type, b.keyAttribute()),
+				Subject:  b.DeclRange.Ptr(),
+			},
+		}
+	}
+	return nil
+}
+
+// mergeBackendBlock merges the backend{} block from a parent to a terrafile.
+// If the backend types are the same, the attributes are merged and the child
+// attributes override the parent attributes. Otherwise the child backend
+// replaces the parent backend
+func (t *Terrafile) mergeBackendBlock(parent *Terrafile) {
+	if parent.BackendBlock == nil {
+		return
+	}
+	if t.BackendBlock == nil {
+		block := *parent.BackendBlock
+		t.BackendBlock = &block
+		return
+	}
+	if t.BackendBlock.Type != parent.BackendBlock.Type {
+		return
+	}
+	var (
+		block  = t.BackendBlock
+		merged = &TerraBackend{
+			Type:         block.Type,
+			KeyPattern:   block.KeyPattern,
+			KeyAttribute: block.KeyAttribute,
+			Attributes:   make(hcl.Attributes, len(block.Attributes)+len(parent.BackendBlock.Attributes)),
+			DeclRange:    block.DeclRange,
+		}
+	)
+	if merged.KeyAttribute == "" {
+		merged.KeyAttribute = parent.BackendBlock.KeyAttribute
+	}
+	for name, attr := range parent.BackendBlock.Attributes {
+		merged.Attributes[name] = attr
+	}
+	// A key set explicitly replaces an inherited key pattern, and vice versa
+	_, hasKey := block.Attributes[merged.keyAttribute()]
+	if merged.KeyPattern == "" && !hasKey {
+		merged.KeyPattern = parent.BackendBlock.KeyPattern
+	}
+	if merged.KeyPattern != "" {
+		delete(merged.Attributes, merged.keyAttribute())
+	}
+	for name, attr := range block.Attributes {
+		merged.Attributes[name] = attr
+	}
+	t.BackendBlock = merged
+}
+
+// resolveBackend evaluates the attributes of the backend{} block and generates
+// the key from the key pattern, if one is given
+func (t *Terrafile) resolveBackend(r *resolver) error {
+	if t.BackendBlock == nil {
+		return nil
+	}
+	var (
+		diags  hcl.Diagnostics
+		config = make(map[string]cty.Value, len(t.BackendBlock.Attributes)+1)
+	)
+	for name, attr := range t.BackendBlock.Attributes {
+		diags = append(diags, r.resolveReferences(attr.Expr)...)
+		value, valueDiags := attr.Expr.Value(r.evalCtx(filepath.Dir(attr.Range.Filename)))
+		diags = append(diags, valueDiags...)
+		config[name] = value
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	if t.BackendBlock.KeyPattern != "" {
+		data, dataErr := t.BuildData()
+		if dataErr != nil {
+			return fmt.Errorf("getting build data for backend key pattern: %w", dataErr)
+		}
+		key, execErr := ExecTemplate(data, "key_pattern", t.BackendBlock.KeyPattern)
+		if execErr != nil {
+			return hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid backend key pattern",
+					Detail:   fmt.Sprintf("Templating key_pattern for backend \"%s\": %s.", t.BackendBlock.Type, execErr.Error()),
+					Subject:  t.BackendBlock.DeclRange.Ptr(),
+				},
+			}
+		}
+		config[t.BackendBlock.keyAttribute()] = cty.StringVal(key.String())
+	}
+	t.BackendBlock.Config = config
+	return nil
+}
+
+// checkBackends returns an error if any root modules have backends with the
+// same state, as they would overwrite each other's state
+func (c *TerraConfig) checkBackends() error {
+	var (
+		states   = make(map[string]*Terrafile)
+		conflict []string
+	)
+	for _, tf := range c.RootModules() {
+		if tf.BackendBlock == nil {
+			continue
+		}
+		state, stateErr := tf.BackendBlock.stateID(tf.Dir)
+		if stateErr != nil {
+			return fmt.Errorf("checking backend for terrafile %s: %w", tf.Path, stateErr)
+		}
+		if state == "" {
+			continue
+		}
+		if other, ok := states[state]; ok {
+			conflict = append(conflict, fmt.Sprintf("%s and %s", other.Path, tf.Path))
+			continue
+		}
+		states[state] = tf
+	}
+	if len(conflict) > 0 {
+		sort.Strings(conflict)
+		return fmt.Errorf("root modules have backends that would use the same state: %s", strings.Join(conflict, ", "))
+	}
+	return nil
+}
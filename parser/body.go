@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// Namespaces that only exist in Terraplate, so expressions that reference them
+// must be evaluated before being written to Terraform files
+const eachNamespace = "each"
+
+var terraplateOnlyNamespaces = map[string]bool{
+	valuesNamespace: true,
+	eachNamespace:   true,
+}
+
+// bodyRenderer writes HCL bodies from a Terrafile into Terraform files.
+// Expressions that only reference Terraplate values (values.* and each.*), or
+// nothing at all, are evaluated. Any other expressions, such as those
+// referencing local.* or var.*, are written as they are so that Terraform
+// evaluates them
+type bodyRenderer struct {
+	ctx *hcl.EvalContext
+	// sources caches the contents of the files that expressions are read from
+	sources map[string][]byte
+}
+
+func newBodyRenderer(ctx *hcl.EvalContext) *bodyRenderer {
+	return &bodyRenderer{
+		ctx:     ctx,
+		sources: make(map[string][]byte),
+	}
+}
+
+// render writes the attributes and blocks of src to dst. Attributes whose
+// names are in skip are not written
+func (r *bodyRenderer) render(dst *hclwrite.Body, src *hclsyntax.Body, skip ...string) hcl.Diagnostics {
+	var (
+		diags     hcl.Diagnostics
+		skipNames = make(map[string]bool, len(skip))
+	)
+	for _, name := range skip {
+		skipNames[name] = true
+	}
+	var names = make([]string, 0, len(src.Attributes))
+	for name := range src.Attributes {
+		if !skipNames[name] {
+			names = append(names, name)
+		}
+	}
+	// Sort the attributes to avoid lots of changes each time
+	sort.Strings(names)
+	for _, name := range names {
+		tokens, exprDiags := r.exprTokens(src.Attributes[name].Expr)
+		diags = append(diags, exprDiags...)
+		if exprDiags.HasErrors() {
+			continue
+		}
+		dst.SetAttributeRaw(name, tokens)
+	}
+	for _, block := range src.Blocks {
+		dstBlock := hclwrite.NewBlock(block.Type, block.Labels)
+		diags = append(diags, r.render(dstBlock.Body(), block.Body)...)
+		dst.AppendBlock(dstBlock)
+	}
+	return diags
+}
+
+// exprTokens returns the tokens to write for an expression, either by
+// evaluating the expression or by using the source
+func (r *bodyRenderer) exprTokens(expr hclsyntax.Expression) (hclwrite.Tokens, hcl.Diagnostics) {
+	var terraplateRefs, terraformRefs bool
+	for _, traversal := range expr.Variables() {
+		if terraplateOnlyNamespaces[traversal.RootName()] {
+			terraplateRefs = true
+			continue
+		}
+		terraformRefs = true
+	}
+	switch {
+	case terraplateRefs && terraformRefs:
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Cannot mix Terraplate and Terraform references",
+				Detail:   "An expression that references values.* or each.* is evaluated by Terraplate, so it cannot also reference things that are evaluated by Terraform, such as local.* or var.*. Use a local that combines them instead.",
+				Subject:  expr.Range().Ptr(),
+			},
+		}
+	case terraformRefs:
+		return r.sourceTokens(expr.Range())
+	default:
+		value, diags := expr.Value(r.ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		return hclwrite.TokensForValue(value), diags
+	}
+}
+
+// sourceTokens returns the source of the given range as tokens
+func (r *bodyRenderer) sourceTokens(rng hcl.Range) (hclwrite.Tokens, hcl.Diagnostics) {
+	src, ok := r.sources[rng.Filename]
+	if !ok {
+		var readErr error
+		src, readErr = os.ReadFile(rng.Filename)
+		if readErr != nil {
+			return nil, hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to read source",
+					Detail:   fmt.Sprintf("Reading file %s: %s.", rng.Filename, readErr.Error()),
+					Subject:  rng.Ptr(),
+				},
+			}
+		}
+		r.sources[rng.Filename] = src
+	}
+	return hclwrite.Tokens{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: rng.SliceBytes(src),
+		},
+	}, nil
+}
+
+// syntaxBody returns the body as it was written in the Terrafile. Bodies are
+// always native syntax bodies as Terrafiles are parsed from HCL files
+func syntaxBody(body hcl.Body) *hclsyntax.Body {
+	if body, ok := body.(*hclsyntax.Body); ok {
+		return body
+	}
+	return &hclsyntax.Body{}
+}
+
+// mergeBodies returns a new body with the attributes and blocks of body and
+// parent. Attributes from body override attributes from parent by name, and
+// blocks from body replace all blocks of the same type from parent
+func mergeBodies(body *hclsyntax.Body, parent *hclsyntax.Body) *hclsyntax.Body {
+	var merged = &hclsyntax.Body{
+		Attributes: make(hclsyntax.Attributes, len(body.Attributes)+len(parent.Attributes)),
+		SrcRange:   body.SrcRange,
+		EndRange:   body.EndRange,
+	}
+	for name, attr := range parent.Attributes {
+		merged.Attributes[name] = attr
+	}
+	for name, attr := range body.Attributes {
+		merged.Attributes[name] = attr
+	}
+	var blockTypes = make(map[string]bool)
+	for _, block := range body.Blocks {
+		blockTypes[block.Type] = true
+	}
+	for _, block := range parent.Blocks {
+		if !blockTypes[block.Type] {
+			merged.Blocks = append(merged.Blocks, block)
+		}
+	}
+	merged.Blocks = append(merged.Blocks, body.Blocks...)
+	return merged
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/imdario/mergo"
+)
+
+// BuildBlock defines the build{} block within a Terrafile, which configures
+// how the files of all templates are built
+type BuildBlock struct {
+	// Header is written at the top of generated files as comment lines, using
+	// the comment syntax of the target file, and can include Go templates.
+	// An empty string disables the header. Defaults to a note that the file
+	// was generated by Terraplate
+	Header *string `hcl:"header,optional"`
+	// JSONHeaderKey embeds the header as a key in generated JSON objects, as
+	// JSON does not support comments. By default JSON files have no header
+	JSONHeaderKey string `hcl:"json_header_key,optional"`
+	// DeclRange is the range of the build block in the Terrafile
+	DeclRange hcl.Range
+}
+
+func (t *Terrafile) mergeBuildBlock(parent *Terrafile) error {
+	if parent.BuildBlock == nil {
+		return nil
+	}
+	if t.BuildBlock == nil {
+		t.BuildBlock = &BuildBlock{}
+	}
+	if err := mergo.Merge(t.BuildBlock, parent.BuildBlock); err != nil {
+		return fmt.Errorf("merging build{} block: %w", err)
+	}
+	return nil
+}
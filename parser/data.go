@@ -5,7 +5,9 @@ type BuildData struct {
 	Locals    map[string]interface{}
 	Variables map[string]interface{}
 	Values    map[string]interface{}
-	Terrafile *Terrafile
+	// Dependencies contains the outputs of each dependency{} block by name
+	Dependencies map[string]interface{}
+	Terrafile    *Terrafile
 	// RelativeDir is the relative directory from the root Terrafile to the
 	// Terrafile being built
 	RelativeDir string
@@ -16,4 +18,13 @@ type BuildData struct {
 	RelativeRootDir string
 	// RootDir is the absolute directory of the root Terrafile
 	RootDir string
+	// Each contains the element of the for_each of the template being built,
+	// if the template uses for_each
+	Each *EachData
+}
+
+// EachData defines the element of the for_each of a template being built
+type EachData struct {
+	Key   string
+	Value interface{}
 }
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TerraDependency defines the dependency{} block within a Terrafile, which
+// makes the outputs of another root module available to the Go templates as
+// .Dependencies.<name>.<output>.
+// Like depends_on, dependencies are not inherited and the root module is run
+// after the root module it depends on
+type TerraDependency struct {
+	Name string `hcl:",label"`
+	// Path is the directory of the root module, relative to the Terrafile
+	Path string `hcl:"path,attr"`
+	// MockOutputs are used when the outputs are not available, e.g. when the
+	// root module has not been applied yet
+	MockOutputs cty.Value `hcl:"mock_outputs,optional"`
+	// MockOutputsAllowedOnApply allows the mock outputs to be used when
+	// applying, which could apply the mock values
+	MockOutputsAllowedOnApply bool `hcl:"mock_outputs_allowed_on_apply,optional"`
+	// DeclRange is the range of the dependency block in the Terrafile
+	DeclRange hcl.Range
+
+	// Dir is the directory of the root module, once the Terrafiles have been
+	// resolved
+	Dir string
+	// Outputs contains the outputs of the root module, once they have been
+	// read. Until then, the mock outputs are used
+	Outputs map[string]interface{}
+
+	// module is the root module, if it was parsed
+	module *Terrafile
+}
+
+// Module returns the root module of the dependency, or nil if it is outside of
+// the parsed directories
+func (d *TerraDependency) Module() *Terrafile {
+	return d.module
+}
+
+// HasMockOutputs returns true if the dependency defines mock outputs
+func (d *TerraDependency) HasMockOutputs() bool {
+	return !d.MockOutputs.IsNull()
+}
+
+func (d *TerraDependency) validate() error {
+	if d.Path == "" {
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid dependency path",
+				Detail:   fmt.Sprintf("The path of dependency \"%s\" must not be empty.", d.Name),
+				Subject:  d.DeclRange.Ptr(),
+			},
+		}
+	}
+	if d.HasMockOutputs() && !d.MockOutputs.Type().IsObjectType() && !d.MockOutputs.Type().IsMapType() {
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid mock_outputs argument",
+				Detail:   fmt.Sprintf("The mock_outputs of dependency \"%s\" must be a map of outputs.", d.Name),
+				Subject:  d.DeclRange.Ptr(),
+			},
+		}
+	}
+	return nil
+}
+
+// outputs returns the outputs of the dependency as Go values, falling back to
+// the mock outputs if the outputs have not been read
+func (d *TerraDependency) outputs() (map[string]interface{}, error) {
+	if d.Outputs != nil {
+		return d.Outputs, nil
+	}
+	if !d.HasMockOutputs() {
+		return nil, nil
+	}
+	outputs, err := fromCtyValues(d.MockOutputs.AsValueMap())
+	if err != nil {
+		return nil, fmt.Errorf("converting mock_outputs of dependency \"%s\" into Go values: %w", d.Name, err)
+	}
+	return outputs, nil
+}
+
+// dependency returns the dependency with the given name, or nil
+func (t *Terrafile) dependency(name string) *TerraDependency {
+	for _, dep := range t.Dependencies {
+		if dep.Name == name {
+			return dep
+		}
+	}
+	return nil
+}
+
+// DependenciesAsGo returns the outputs of the dependencies as Go values, for
+// the Go templates
+func (t *Terrafile) DependenciesAsGo() (map[string]interface{}, error) {
+	var deps = make(map[string]interface{}, len(t.Dependencies))
+	for _, dep := range t.Dependencies {
+		outputs, err := dep.outputs()
+		if err != nil {
+			return nil, err
+		}
+		if outputs == nil {
+			continue
+		}
+		deps[dep.Name] = outputs
+	}
+	return deps, nil
+}
+
+// resolveDependencies sets the directory of each dependency relative to the
+// Terrafile
+func (t *Terrafile) resolveDependencies() {
+	for _, dep := range t.Dependencies {
+		dir := dep.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(t.Dir, dir)
+		}
+		dep.Dir = filepath.Clean(dir)
+	}
+}
@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DependsOn returns the root modules that this root module depends on, as
+// declared by depends_on in the exec{} block and by the dependency{} blocks.
+// Dependencies outside of the parsed directories are not included
+func (t *Terrafile) DependsOn() []*Terrafile {
+	return t.dependsOn
+}
+
+// resolveDependsOn finds the root modules declared by depends_on in the exec{}
+// block and by the dependency{} blocks of each root module, and returns an
+// error if a dependency is not a root module or if the dependencies contain a
+// cycle
+func (c *TerraConfig) resolveDependsOn() error {
+	var (
+		rootModules = c.RootModules()
+		modulesDir  = make(map[string]*Terrafile, len(rootModules))
+		terrafiles  = make(map[string]*Terrafile, len(c.Terrafiles))
+	)
+	for _, tf := range c.Terrafiles {
+		terrafiles[filepath.Clean(tf.Dir)] = tf
+	}
+	for _, tf := range rootModules {
+		modulesDir[filepath.Clean(tf.Dir)] = tf
+	}
+	// findModule returns the root module in the directory, or nil if the
+	// directory exists but is outside of the parsed directories, in which case
+	// it is not part of the run and there is nothing to wait for
+	findModule := func(dir string) (*Terrafile, error) {
+		if dep, ok := modulesDir[dir]; ok {
+			return dep, nil
+		}
+		if _, ok := terrafiles[dir]; ok {
+			return nil, fmt.Errorf("%s is not a root module", dir)
+		}
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return nil, statErr
+		}
+		return nil, nil
+	}
+	for _, tf := range rootModules {
+		tf.dependsOn = nil
+		addDependsOn := func(dep *Terrafile) {
+			for _, existing := range tf.dependsOn {
+				if existing == dep {
+					return
+				}
+			}
+			tf.dependsOn = append(tf.dependsOn, dep)
+		}
+		if tf.ExecBlock != nil {
+			for _, path := range tf.ExecBlock.DependsOn {
+				dir := path
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(tf.Dir, path)
+				}
+				dep, findErr := findModule(filepath.Clean(dir))
+				if findErr != nil {
+					return fmt.Errorf("terrafile %s: depends_on \"%s\": %w", tf.Path, path, findErr)
+				}
+				if dep != nil {
+					addDependsOn(dep)
+				}
+			}
+		}
+		tf.resolveDependencies()
+		for _, dependency := range tf.Dependencies {
+			dep, findErr := findModule(dependency.Dir)
+			if findErr != nil {
+				return fmt.Errorf("terrafile %s: dependency \"%s\": %w", tf.Path, dependency.Name, findErr)
+			}
+			dependency.module = dep
+			if dep != nil {
+				addDependsOn(dep)
+			}
+		}
+	}
+	if err := checkDestroyArgs(rootModules); err != nil {
+		return err
+	}
+	return checkDependsOnCycles(rootModules)
+}
+
+// checkDestroyArgs returns an error if a root module with dependencies, or
+// that other root modules depend on, destroys its resources using -destroy in
+// the extra_args of the exec{} block. The runner can only reverse the order
+// of the root modules when -destroy is passed on the command line
+func checkDestroyArgs(rootModules []*Terrafile) error {
+	for _, tf := range rootModules {
+		for _, dep := range tf.dependsOn {
+			for _, module := range []*Terrafile{tf, dep} {
+				if module.ExecBlock == nil || !containsDestroyArg(module.ExecBlock.ExtraArgs) {
+					continue
+				}
+				return fmt.Errorf("terrafile %s: -destroy in extra_args cannot be used by root modules with dependencies, as they would not be destroyed in reverse order: pass -destroy on the command line instead", module.Path)
+			}
+		}
+	}
+	return nil
+}
+
+func containsDestroyArg(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-destroy", "--destroy", "-destroy=true", "--destroy=true":
+			return true
+		}
+	}
+	return false
+}
+
+// checkDependsOnCycles returns an error if the root modules depend on
+// themselves, directly or through other root modules
+func checkDependsOnCycles(rootModules []*Terrafile) error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	var (
+		state = make(map[*Terrafile]int, len(rootModules))
+		stack []*Terrafile
+		visit func(tf *Terrafile) error
+	)
+	visit = func(tf *Terrafile) error {
+		switch state[tf] {
+		case visited:
+			return nil
+		case visiting:
+			var cycle []string
+			for index, stackTf := range stack {
+				if stackTf == tf {
+					for _, cycleTf := range stack[index:] {
+						cycle = append(cycle, cycleTf.Dir)
+					}
+					break
+				}
+			}
+			cycle = append(cycle, tf.Dir)
+			return fmt.Errorf("cycle in dependencies: %s", strings.Join(cycle, " -> "))
+		}
+		state[tf] = visiting
+		stack = append(stack, tf)
+		for _, dep := range tf.dependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[tf] = visited
+		return nil
+	}
+	for _, tf := range rootModules {
+		if err := visit(tf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
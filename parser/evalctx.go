@@ -1,20 +1,461 @@
 package parser
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 func evalCtx(dir string) *hcl.EvalContext {
+	var funcs = map[string]function.Function{
+		"read_template": readTemplateFunc(dir),
+		"values_file":   valuesFileFunc(dir),
+		"file":          fileFunc(dir),
+		"fileexists":    fileExistsFunc(dir),
+		"yamldecode":    ctyyaml.YAMLDecodeFunc,
+		"yamlencode":    ctyyaml.YAMLEncodeFunc,
+		"env":           envFunc,
+		"abspath":       absPathFunc(dir),
+		"basename":      baseNameFunc,
+		"dirname":       dirNameFunc,
+		"index":         indexFunc,
+		"startswith":    startsWithFunc,
+		"endswith":      endsWithFunc,
+		"alltrue":       allTrueFunc,
+		"anytrue":       anyTrueFunc,
+		"sum":           sumFunc,
+		"one":           oneFunc,
+		"base64encode":  base64EncodeFunc,
+		"base64decode":  base64DecodeFunc,
+		"try":           tryfunc.TryFunc,
+		"can":           tryfunc.CanFunc,
+	}
+	for name, fn := range stdlibFuncs {
+		funcs[name] = fn
+	}
 	return &hcl.EvalContext{
-		Functions: map[string]function.Function{
-			"read_template": readTemplateFunc(dir),
+		Functions: funcs,
+	}
+}
+
+// stdlibFuncs contains the functions from the cty standard library, using the
+// same names as Terraform
+var stdlibFuncs = map[string]function.Function{
+	"abs":                    stdlib.AbsoluteFunc,
+	"ceil":                   stdlib.CeilFunc,
+	"chomp":                  stdlib.ChompFunc,
+	"chunklist":              stdlib.ChunklistFunc,
+	"coalesce":               stdlib.CoalesceFunc,
+	"coalescelist":           stdlib.CoalesceListFunc,
+	"compact":                stdlib.CompactFunc,
+	"concat":                 stdlib.ConcatFunc,
+	"contains":               stdlib.ContainsFunc,
+	"csvdecode":              stdlib.CSVDecodeFunc,
+	"distinct":               stdlib.DistinctFunc,
+	"element":                stdlib.ElementFunc,
+	"flatten":                stdlib.FlattenFunc,
+	"floor":                  stdlib.FloorFunc,
+	"format":                 stdlib.FormatFunc,
+	"formatdate":             stdlib.FormatDateFunc,
+	"formatlist":             stdlib.FormatListFunc,
+	"indent":                 stdlib.IndentFunc,
+	"join":                   stdlib.JoinFunc,
+	"jsondecode":             stdlib.JSONDecodeFunc,
+	"jsonencode":             stdlib.JSONEncodeFunc,
+	"keys":                   stdlib.KeysFunc,
+	"length":                 stdlib.LengthFunc,
+	"log":                    stdlib.LogFunc,
+	"lookup":                 stdlib.LookupFunc,
+	"lower":                  stdlib.LowerFunc,
+	"max":                    stdlib.MaxFunc,
+	"merge":                  stdlib.MergeFunc,
+	"min":                    stdlib.MinFunc,
+	"parseint":               stdlib.ParseIntFunc,
+	"pow":                    stdlib.PowFunc,
+	"range":                  stdlib.RangeFunc,
+	"regex":                  stdlib.RegexFunc,
+	"regexall":               stdlib.RegexAllFunc,
+	"replace":                stdlib.ReplaceFunc,
+	"reverse":                stdlib.ReverseListFunc,
+	"setintersection":        stdlib.SetIntersectionFunc,
+	"setproduct":             stdlib.SetProductFunc,
+	"setsubtract":            stdlib.SetSubtractFunc,
+	"setsymmetricdifference": stdlib.SetSymmetricDifferenceFunc,
+	"setunion":               stdlib.SetUnionFunc,
+	"signum":                 stdlib.SignumFunc,
+	"slice":                  stdlib.SliceFunc,
+	"sort":                   stdlib.SortFunc,
+	"split":                  stdlib.SplitFunc,
+	"strrev":                 stdlib.ReverseFunc,
+	"substr":                 stdlib.SubstrFunc,
+	"timeadd":                stdlib.TimeAddFunc,
+	"title":                  stdlib.TitleFunc,
+	"tobool":                 stdlib.MakeToFunc(cty.Bool),
+	"tolist":                 stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+	"tomap":                  stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+	"tonumber":               stdlib.MakeToFunc(cty.Number),
+	"toset":                  stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+	"tostring":               stdlib.MakeToFunc(cty.String),
+	"trim":                   stdlib.TrimFunc,
+	"trimprefix":             stdlib.TrimPrefixFunc,
+	"trimspace":              stdlib.TrimSpaceFunc,
+	"trimsuffix":             stdlib.TrimSuffixFunc,
+	"upper":                  stdlib.UpperFunc,
+	"values":                 stdlib.ValuesFunc,
+	"zipmap":                 stdlib.ZipmapFunc,
+}
+
+// envFunc is an HCL function that returns the value of an environment
+// variable, or an empty string if it is not set
+var envFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "name",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(os.Getenv(args[0].AsString())), nil
+	},
+})
+
+// indexFunc is an HCL function that returns the index of the first element
+// in a list that is equal to the value, like the Terraform index function.
+// The index function of the cty standard library looks up an element by its
+// key instead
+var indexFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "value",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		list := args[0]
+		if !list.Type().IsListType() && !list.Type().IsTupleType() {
+			return cty.NilVal, fmt.Errorf("argument must be a list or tuple")
+		}
+		if !list.IsKnown() {
+			return cty.UnknownVal(cty.Number), nil
+		}
+		for it := list.ElementIterator(); it.Next(); {
+			index, element := it.Element()
+			equal, err := stdlib.Equal(element, args[1])
+			if err != nil {
+				return cty.NilVal, err
+			}
+			if !equal.IsKnown() {
+				return cty.UnknownVal(cty.Number), nil
+			}
+			if equal.True() {
+				return index, nil
+			}
+		}
+		return cty.NilVal, fmt.Errorf("item not found")
+	},
+})
+
+// startsWithFunc is an HCL function that returns whether a string starts with
+// a prefix
+var startsWithFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.BoolVal(strings.HasPrefix(args[0].AsString(), args[1].AsString())), nil
+	},
+})
+
+// endsWithFunc is an HCL function that returns whether a string ends with a
+// suffix
+var endsWithFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+		{
+			Name: "suffix",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.BoolVal(strings.HasSuffix(args[0].AsString(), args[1].AsString())), nil
+	},
+})
+
+// allTrueFunc is an HCL function that returns true if all the elements of a
+// list are true, or if the list is empty
+var allTrueFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.List(cty.Bool),
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		result := cty.True
+		for it := args[0].ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			if element.IsNull() {
+				return cty.False, nil
+			}
+			result = result.And(element)
+			if result.IsKnown() && result.False() {
+				return cty.False, nil
+			}
+		}
+		return result, nil
+	},
+})
+
+// anyTrueFunc is an HCL function that returns true if any of the elements of
+// a list is true, and false if the list is empty
+var anyTrueFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.List(cty.Bool),
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		result := cty.False
+		for it := args[0].ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			if element.IsNull() {
+				continue
+			}
+			result = result.Or(element)
+			if result.IsKnown() && result.True() {
+				return cty.True, nil
+			}
+		}
+		return result, nil
+	},
+})
+
+// sumFunc is an HCL function that returns the sum of the numbers in a list or
+// set
+var sumFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		list := args[0]
+		ty := list.Type()
+		if !ty.IsListType() && !ty.IsSetType() && !ty.IsTupleType() {
+			return cty.NilVal, fmt.Errorf("argument must be a list, set or tuple of numbers")
+		}
+		if !list.IsWhollyKnown() {
+			return cty.UnknownVal(cty.Number), nil
+		}
+		if list.LengthInt() == 0 {
+			return cty.NilVal, fmt.Errorf("cannot sum an empty list")
+		}
+		sum := cty.Zero
+		for it := list.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			if element.IsNull() {
+				return cty.NilVal, fmt.Errorf("argument must not contain null values")
+			}
+			number, convErr := convert.Convert(element, cty.Number)
+			if convErr != nil {
+				return cty.NilVal, fmt.Errorf("argument must be a list, set or tuple of numbers: %w", convErr)
+			}
+			sum = sum.Add(number)
+		}
+		return sum, nil
+	},
+})
+
+// oneFunc is an HCL function that returns the only element of a list, set or
+// tuple, or null if it is empty. It is an error to have more than one element
+var oneFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		ty := args[0].Type()
+		switch {
+		case ty == cty.DynamicPseudoType:
+			return cty.DynamicPseudoType, nil
+		case ty.IsListType() || ty.IsSetType():
+			return ty.ElementType(), nil
+		case ty.IsTupleType():
+			switch len(ty.TupleElementTypes()) {
+			case 0:
+				return cty.DynamicPseudoType, nil
+			case 1:
+				return ty.TupleElementType(0), nil
+			}
+			return cty.NilType, fmt.Errorf("must be a list, set or tuple value with either zero or one elements")
+		}
+		return cty.NilType, fmt.Errorf("must be a list, set or tuple value with either zero or one elements")
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		list := args[0]
+		if !list.IsKnown() {
+			return cty.UnknownVal(retType), nil
+		}
+		if list.IsNull() {
+			return cty.NilVal, fmt.Errorf("argument must not be null")
+		}
+		switch list.LengthInt() {
+		case 0:
+			return cty.NullVal(retType), nil
+		case 1:
+			it := list.ElementIterator()
+			it.Next()
+			_, element := it.Element()
+			return element, nil
+		}
+		return cty.NilVal, fmt.Errorf("must be a list, set or tuple value with either zero or one elements")
+	},
+})
+
+// base64EncodeFunc is an HCL function that encodes a string with base64
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+// base64DecodeFunc is an HCL function that decodes a base64 string, which
+// must decode to valid UTF-8
+var base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		decoded, decodeErr := base64.StdEncoding.DecodeString(args[0].AsString())
+		if decodeErr != nil {
+			return cty.NilVal, fmt.Errorf("decoding base64: %w", decodeErr)
+		}
+		if !utf8.Valid(decoded) {
+			return cty.NilVal, fmt.Errorf("the decoded result is not valid UTF-8")
+		}
+		return cty.StringVal(string(decoded)), nil
+	},
+})
+
+// absPathFunc creates an HCL function that returns the absolute path of a
+// path. Relative paths are relative to the directory provided
+func absPathFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			absPath, absErr := filepath.Abs(path)
+			if absErr != nil {
+				return cty.NilVal, fmt.Errorf("getting absolute path for %s: %w", path, absErr)
+			}
+			return cty.StringVal(filepath.ToSlash(absPath)), nil
+		},
+	})
+}
+
+// baseNameFunc is an HCL function that returns the last element of a path
+var baseNameFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "path",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(filepath.Base(args[0].AsString())), nil
+	},
+})
+
+// dirNameFunc is an HCL function that returns all but the last element of a
+// path
+var dirNameFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "path",
+			Type: cty.String,
 		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(filepath.Dir(args[0].AsString())), nil
+	},
+})
+
+// terrafileFuncs creates the HCL functions that depend on the Terrafile
+// (root module) being evaluated
+func terrafileFuncs(t *Terrafile) map[string]function.Function {
+	return map[string]function.Function{
+		"relative_dir": function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				return cty.StringVal(filepath.ToSlash(t.RelativeDir())), nil
+			},
+		}),
+		"root_dir": function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				return cty.StringVal(filepath.ToSlash(t.RootDir())), nil
+			},
+		}),
 	}
 }
 
@@ -37,42 +478,10 @@ func readTemplateFunc(dir string) function.Function {
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 			file := args[0].AsString()
 
-			var (
-				contents string
-				found    bool
-				readErr  error
-			)
-			travErr := TraverseUpDirectory(dir, func(travDir string) (bool, error) {
-				var path string
-				// Check if there is a template file first in the templates
-				// directory, and then in the directory we are traversing
-				path = filepath.Join(travDir, "templates", file)
-				contents, found, readErr = readTemplate(path)
-				if readErr != nil {
-					return false, readErr
-				}
-				if found {
-					// Indicate not to continue traversing
-					return false, nil
-				}
-
-				// Try again without the templates directory
-				path = filepath.Join(travDir, file)
-				contents, found, readErr = readTemplate(path)
-				if readErr != nil {
-					return false, readErr
-				}
-				if found {
-					// Indicate not to continue traversing
-					return false, nil
-				}
-				// If not found, and no errors, continue traversing
-				return true, nil
-			})
-			if travErr != nil {
-				return cty.NilVal, fmt.Errorf("")
+			contents, _, found, findErr := findFileUp(dir, file, "templates", "")
+			if findErr != nil {
+				return cty.NilVal, findErr
 			}
-
 			if !found {
 				return cty.NilVal, fmt.Errorf("could not find template %s", file)
 			}
@@ -82,6 +491,164 @@ func readTemplateFunc(dir string) function.Function {
 	})
 }
 
+// valuesFileFunc creates an HCL function that will read and decode a values
+// file by the given name, starting at the directory provided.
+// It will traverse up directories until it finds a file with that name, like
+// readTemplateFunc, but does not check "templates" directories.
+// The file is decoded based on its extension and can be YAML (.yaml, .yml),
+// JSON (.json) or Terraform variable definitions (.tfvars, .hcl).
+func valuesFileFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "file",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			file := args[0].AsString()
+
+			contents, path, found, findErr := findFileUp(dir, file, "")
+			if findErr != nil {
+				return cty.NilVal, findErr
+			}
+			if !found {
+				return cty.NilVal, fmt.Errorf("could not find values file %s", file)
+			}
+			value, decodeErr := decodeValuesFile(path, []byte(contents))
+			if decodeErr != nil {
+				return cty.NilVal, fmt.Errorf("decoding values file %s: %w", path, decodeErr)
+			}
+			return value, nil
+		},
+	})
+}
+
+// fileFunc creates an HCL function that reads the contents of a file.
+// Relative paths are relative to the directory provided
+func fileFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			bytes, readErr := os.ReadFile(path)
+			if readErr != nil {
+				return cty.NilVal, fmt.Errorf("reading file %s: %w", path, readErr)
+			}
+			return cty.StringVal(string(bytes)), nil
+		},
+	})
+}
+
+// fileExistsFunc creates an HCL function that returns whether a file exists.
+// Relative paths are relative to the directory provided
+func fileExistsFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			info, statErr := os.Stat(path)
+			if statErr != nil {
+				if os.IsNotExist(statErr) {
+					return cty.False, nil
+				}
+				return cty.NilVal, fmt.Errorf("checking file %s: %w", path, statErr)
+			}
+			if !info.Mode().IsRegular() {
+				return cty.NilVal, fmt.Errorf("%s is not a regular file", path)
+			}
+			return cty.True, nil
+		},
+	})
+}
+
+// decodeValuesFile decodes the contents of a values file based on the file
+// extension
+func decodeValuesFile(path string, contents []byte) (cty.Value, error) {
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		return ctyyaml.Standard.Unmarshal(contents, cty.DynamicPseudoType)
+	case ".json":
+		ty, typeErr := ctyjson.ImpliedType(contents)
+		if typeErr != nil {
+			return cty.NilVal, typeErr
+		}
+		return ctyjson.Unmarshal(contents, ty)
+	case ".tfvars", ".hcl":
+		file, diags := hclsyntax.ParseConfig(contents, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+		attrs, diags := file.Body.JustAttributes()
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+		var values = make(map[string]cty.Value, len(attrs))
+		for name, attr := range attrs {
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				return cty.NilVal, diags
+			}
+			values[name] = value
+		}
+		return cty.ObjectVal(values), nil
+	default:
+		return cty.NilVal, fmt.Errorf("unsupported file extension \"%s\": supported extensions are %s", ext, strings.Join([]string{".yaml", ".yml", ".json", ".tfvars", ".hcl"}, ", "))
+	}
+}
+
+// findFileUp looks for a file by the given name, starting at the directory
+// provided and traversing up directories until the file is found.
+// In each directory, the file is looked for in each of the sub directories
+// given, in order, where an empty string means the directory itself.
+// It returns the contents and path of the first match that it finds
+func findFileUp(dir string, file string, subDirs ...string) (string, string, bool, error) {
+	var (
+		contents string
+		path     string
+		found    bool
+		readErr  error
+	)
+	travErr := TraverseUpDirectory(dir, func(travDir string) (bool, error) {
+		for _, subDir := range subDirs {
+			path = filepath.Join(travDir, subDir, file)
+			contents, found, readErr = readTemplate(path)
+			if readErr != nil {
+				return false, readErr
+			}
+			if found {
+				// Indicate not to continue traversing
+				return false, nil
+			}
+		}
+		// If not found, and no errors, continue traversing
+		return true, nil
+	})
+	if travErr != nil {
+		return "", "", false, fmt.Errorf("looking for file %s from %s: %w", file, dir, travErr)
+	}
+	return contents, path, found, nil
+}
+
 func readTemplate(path string) (string, bool, error) {
 	bytes, readErr := os.ReadFile(path)
 	if readErr != nil {
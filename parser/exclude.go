@@ -0,0 +1,109 @@
+package parser
+
+import "github.com/hashicorp/hcl/v2"
+
+// TerraExclude defines the exclude{} block within a Terrafile, which removes
+// the templates, locals, variables and values inherited from ancestors.
+// Descendants do not inherit the excluded settings either, unless they define
+// them again
+type TerraExclude struct {
+	Templates []string `hcl:"templates,optional"`
+	Locals    []string `hcl:"locals,optional"`
+	Variables []string `hcl:"variables,optional"`
+	Values    []string `hcl:"values,optional"`
+}
+
+// combine adds the exclusions from another exclude{} block in the same
+// directory
+func (e *TerraExclude) combine(other *TerraExclude) {
+	e.Templates = append(e.Templates, other.Templates...)
+	e.Locals = append(e.Locals, other.Locals...)
+	e.Variables = append(e.Variables, other.Variables...)
+	e.Values = append(e.Values, other.Values...)
+}
+
+// withoutExcluded returns a shallow copy of the parent without the settings
+// that the terrafile excludes, so that they are not merged into the terrafile
+func (t *Terrafile) withoutExcluded(parent *Terrafile) *Terrafile {
+	if t.ExcludeBlock == nil {
+		return parent
+	}
+	var (
+		exclude  = t.ExcludeBlock
+		filtered = *parent
+	)
+	if parent.LocalsBlock != nil {
+		filtered.LocalsBlock = &TerraLocals{
+			Attributes: excludeAttributes(parent.LocalsBlock.Attributes, exclude.Locals),
+			Overridden: excludeOverridden(parent.LocalsBlock.Overridden, exclude.Locals),
+		}
+	}
+	if parent.VariablesBlock != nil {
+		filtered.VariablesBlock = &TerraVariables{
+			Attributes: excludeAttributes(parent.VariablesBlock.Attributes, exclude.Variables),
+			Overridden: excludeOverridden(parent.VariablesBlock.Overridden, exclude.Variables),
+		}
+	}
+	if parent.ValuesBlock != nil {
+		filtered.ValuesBlock = &TerraValues{
+			Attributes: excludeAttributes(parent.ValuesBlock.Attributes, exclude.Values),
+			Overridden: excludeOverridden(parent.ValuesBlock.Overridden, exclude.Values),
+		}
+	}
+	filtered.VariableBlocks = nil
+	for _, variable := range parent.VariableBlocks {
+		if !containsString(exclude.Variables, variable.Name) {
+			filtered.VariableBlocks = append(filtered.VariableBlocks, variable)
+		}
+	}
+	filtered.Templates = nil
+	for _, tmpl := range parent.Templates {
+		if !containsString(exclude.Templates, tmpl.Name) {
+			filtered.Templates = append(filtered.Templates, tmpl)
+		}
+	}
+	filtered.origins = make(map[string][]Origin, len(parent.origins))
+	for key, origins := range parent.origins {
+		filtered.origins[key] = origins
+	}
+	for prefix, names := range map[string][]string{
+		"template.":              exclude.Templates,
+		localsNamespace + ".":    exclude.Locals,
+		variablesNamespace + ".": exclude.Variables,
+		valuesNamespace + ".":    exclude.Values,
+	} {
+		for _, name := range names {
+			delete(filtered.origins, prefix+name)
+		}
+	}
+	return &filtered
+}
+
+func excludeAttributes(attrs hcl.Attributes, exclude []string) hcl.Attributes {
+	var filtered = make(hcl.Attributes, len(attrs))
+	for name, attr := range attrs {
+		if !containsString(exclude, name) {
+			filtered[name] = attr
+		}
+	}
+	return filtered
+}
+
+func excludeOverridden(overridden map[string][]*hcl.Attribute, exclude []string) map[string][]*hcl.Attribute {
+	var filtered = make(map[string][]*hcl.Attribute, len(overridden))
+	for name, attrs := range overridden {
+		if !containsString(exclude, name) {
+			filtered[name] = attrs
+		}
+	}
+	return filtered
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
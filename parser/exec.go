@@ -1,9 +1,36 @@
 package parser
 
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
 type ExecBlock struct {
-	Skip      bool           `hcl:"skip,optional"`
+	Skip bool `hcl:"skip,optional"`
+	// Binary is the terraform binary to run, e.g. tofu for OpenTofu.
+	// Defaults to terraform
+	Binary    string         `hcl:"binary,optional"`
 	ExtraArgs []string       `hcl:"extra_args,optional"`
 	PlanBlock *ExecPlanBlock `hcl:"plan,block"`
+	// DependsOn contains the directories of the root modules that must be run
+	// before this one, relative to the directory of the Terrafile.
+	// It is not inherited from ancestors
+	DependsOn []string `hcl:"depends_on,optional"`
+	// EnvAttr defines the environment variables to set when running Terraform,
+	// as an object or map of strings
+	EnvAttr *hcl.Attribute `hcl:"env,optional"`
+	// EnvAttrs contains the env attributes of this exec block and those
+	// inherited from ancestors, ordered from the nearest
+	EnvAttrs []*hcl.Attribute
+	// Env contains the evaluated environment variables once the Terrafile has
+	// been resolved
+	Env map[string]string
+	// DeclRange is the range of the exec block in the Terrafile
+	DeclRange hcl.Range
 }
 
 // ExecPlanBlock defines the arguments for running the Terraform plan
@@ -16,3 +43,55 @@ type ExecPlanBlock struct {
 	// such as running Terraform Cloud remotely, where plans cannot be created.
 	SkipOut bool `hcl:"skip_out,optional"`
 }
+
+// resolveExecBlock evaluates the environment variables of the exec{} block,
+// merging them from the furthest ancestor so that the nearest definition of a
+// variable takes precedence
+func (t *Terrafile) resolveExecBlock(r *resolver) error {
+	if t.ExecBlock == nil {
+		return nil
+	}
+	var (
+		diags hcl.Diagnostics
+		env   = make(map[string]string)
+	)
+	for index := len(t.ExecBlock.EnvAttrs) - 1; index >= 0; index-- {
+		attr := t.ExecBlock.EnvAttrs[index]
+		diags = append(diags, r.resolveReferences(attr.Expr)...)
+		if diags.HasErrors() {
+			return diags
+		}
+		value, valueDiags := attr.Expr.Value(r.evalCtx(filepath.Dir(attr.Range.Filename)))
+		diags = append(diags, valueDiags...)
+		if diags.HasErrors() {
+			return diags
+		}
+		if value.IsNull() {
+			continue
+		}
+		if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+			return diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid env argument",
+				Detail:   "The env argument must be a map of environment variables.",
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+		}
+		for name, envValue := range value.AsValueMap() {
+			strValue, convErr := convert.Convert(envValue, cty.String)
+			if convErr != nil || strValue.IsNull() || !strValue.IsKnown() {
+				return diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid env argument",
+					Detail:   fmt.Sprintf("The environment variable \"%s\" must be a string.", name),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+			}
+			env[name] = strValue.AsString()
+		}
+	}
+	block := *t.ExecBlock
+	block.Env = env
+	t.ExecBlock = &block
+	return nil
+}
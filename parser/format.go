@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"gopkg.in/yaml.v3"
+)
+
+// formatContents validates the generated contents of a target file based on
+// its extension, and formats them if the format supports it.
+// Files with other extensions are returned as they are
+func formatContents(target string, contents []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(target)) {
+	case ".tf", ".hcl":
+		return formatHCL(target, contents)
+	case ".json":
+		return formatJSON(target, contents)
+	case ".yaml", ".yml":
+		return validateYAML(target, contents)
+	}
+	return contents, nil
+}
+
+// formatHCL checks that the contents are valid HCL and formats them
+func formatHCL(target string, contents []byte) ([]byte, error) {
+	_, diags := hclsyntax.ParseConfig(contents, filepath.Base(target), hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("generated file %s is not valid HCL: %s", target, diags.Error())
+	}
+	return hclwrite.Format(contents), nil
+}
+
+// formatJSON checks that the contents are valid JSON and indents them
+func formatJSON(target string, contents []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := json.Indent(&out, contents, "", "  "); err != nil {
+		return nil, fmt.Errorf("generated file %s is not valid JSON: %w", target, err)
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+// validateYAML checks that each document in the contents is valid YAML.
+// The contents are not formatted, as that would lose any comments
+func validateYAML(target string, contents []byte) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return contents, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("generated file %s is not valid YAML: %w", target, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ignoreFile is the name of the file containing patterns (using gitignore
+// syntax) of files and directories to ignore when looking for Terrafiles
+const ignoreFile = ".terraplateignore"
+
+// ignorer decides whether a path should be ignored when walking down the
+// directories looking for Terrafiles
+type ignorer struct {
+	// root is the directory where walking starts
+	root string
+	// base contains the components of root relative to the top-most ancestor
+	// with an ignore file, as patterns are relative to that ancestor
+	base     []string
+	patterns []gitignore.Pattern
+	// exclude contains the patterns given on the command line, which come
+	// after the patterns from the ignore files so that they cannot be negated
+	exclude []gitignore.Pattern
+}
+
+// newIgnorer returns an ignorer for walking down from root, with the exclude
+// patterns relative to root and the patterns from the ignore files of the
+// ancestors of root. The ignore file in root itself is added when walking down
+func newIgnorer(root string, exclude []string) (*ignorer, error) {
+	absRoot, absErr := filepath.Abs(root)
+	if absErr != nil {
+		return nil, fmt.Errorf("getting absolute path for %s: %w", root, absErr)
+	}
+	// Find the ancestors with an ignore file, ordered from the top-most
+	var ancestors []string
+	travErr := TraverseUpDirectory(filepath.Dir(absRoot), func(dir string) (bool, error) {
+		if _, statErr := os.Stat(filepath.Join(dir, ignoreFile)); statErr == nil {
+			ancestors = append([]string{dir}, ancestors...)
+		}
+		return true, nil
+	})
+	if travErr != nil {
+		return nil, fmt.Errorf("looking for ancestor ignore files: %w", travErr)
+	}
+	ancestorIgnore := &ignorer{}
+	if len(ancestors) > 0 {
+		ancestorIgnore.root = ancestors[0]
+	}
+	for _, dir := range ancestors {
+		var ignoreErr error
+		ancestorIgnore, ignoreErr = ancestorIgnore.withIgnoreFile(dir)
+		if ignoreErr != nil {
+			return nil, ignoreErr
+		}
+	}
+
+	var (
+		base            = ancestorIgnore.pathComponents(absRoot)
+		excludePatterns = make([]gitignore.Pattern, 0, len(exclude))
+	)
+	for _, pattern := range exclude {
+		excludePatterns = append(excludePatterns, gitignore.ParsePattern(pattern, base))
+	}
+	return &ignorer{
+		root:     root,
+		base:     base,
+		patterns: ancestorIgnore.patterns,
+		exclude:  excludePatterns,
+	}, nil
+}
+
+// withIgnoreFile returns a new ignorer that also contains the patterns from an
+// ignore file in the given directory, if one exists
+func (i *ignorer) withIgnoreFile(dir string) (*ignorer, error) {
+	path := filepath.Join(dir, ignoreFile)
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		if os.IsNotExist(openErr) {
+			return i, nil
+		}
+		return nil, fmt.Errorf("opening ignore file %s: %w", path, openErr)
+	}
+	defer file.Close()
+
+	var (
+		domain   = i.pathComponents(dir)
+		patterns = append([]gitignore.Pattern{}, i.patterns...)
+		scanner  = bufio.NewScanner(file)
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Skip comments and empty lines
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading ignore file %s: %w", path, err)
+	}
+	return &ignorer{
+		root:     i.root,
+		base:     i.base,
+		patterns: patterns,
+		exclude:  i.exclude,
+	}, nil
+}
+
+// ignore returns true if the path should be ignored
+func (i *ignorer) ignore(path string, isDir bool) bool {
+	if len(i.patterns) == 0 && len(i.exclude) == 0 {
+		return false
+	}
+	// Never ignore the root
+	if relPath, relErr := filepath.Rel(i.root, path); relErr != nil || relPath == "." {
+		return false
+	}
+	// The last matching pattern wins, so the exclude patterns go last
+	patterns := append(append([]gitignore.Pattern{}, i.patterns...), i.exclude...)
+	return gitignore.NewMatcher(patterns).Match(i.pathComponents(path), isDir)
+}
+
+// pathComponents returns the components of the path relative to the top-most
+// ancestor with an ignore file, or to the root if there is none
+func (i *ignorer) pathComponents(path string) []string {
+	components := append([]string{}, i.base...)
+	relPath, relErr := filepath.Rel(i.root, path)
+	if relErr != nil || relPath == "." {
+		return components
+	}
+	return append(components, strings.Split(filepath.ToSlash(relPath), "/")...)
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	mergeStrategyReplace = "replace"
+	mergeStrategyDeep    = "deep"
+
+	mergeListsReplace = "replace"
+	mergeListsAppend  = "append"
+)
+
+// TerraMerge defines the merge{} block within a Terrafile, which controls how
+// the locals, variables or values are merged with those inherited from ancestors
+type TerraMerge struct {
+	// Block is the name of the block to configure: locals, variables or values
+	Block string `hcl:",label"`
+	// Strategy is either "replace" (default), where a child replaces the value
+	// of an ancestor, or "deep", where objects and maps are merged recursively
+	Strategy string `hcl:"strategy,optional"`
+	// Lists is either "replace" (default) or "append" and controls how lists
+	// are merged when deep merging
+	Lists string `hcl:"lists,optional"`
+	// Keys limits the merge strategy to the given keys. If empty, the strategy
+	// applies to all keys in the block
+	Keys []string `hcl:"keys,optional"`
+	// DeclRange is the range of the merge block in the Terrafile
+	DeclRange hcl.Range
+}
+
+func (m *TerraMerge) validate() error {
+	switch m.Block {
+	case "locals", "variables", "values":
+	default:
+		return fmt.Errorf("merge block \"%s\": must be one of locals, variables or values", m.Block)
+	}
+	switch m.Strategy {
+	case "", mergeStrategyReplace, mergeStrategyDeep:
+	default:
+		return fmt.Errorf("merge block \"%s\": unsupported strategy \"%s\": must be %s or %s", m.Block, m.Strategy, mergeStrategyReplace, mergeStrategyDeep)
+	}
+	switch m.Lists {
+	case "", mergeListsReplace, mergeListsAppend:
+	default:
+		return fmt.Errorf("merge block \"%s\": unsupported lists \"%s\": must be %s or %s", m.Block, m.Lists, mergeListsReplace, mergeListsAppend)
+	}
+	return nil
+}
+
+// isDeep returns true if the given key should be deep merged
+func (m *TerraMerge) isDeep(key string) bool {
+	if m == nil || m.Strategy != mergeStrategyDeep {
+		return false
+	}
+	if len(m.Keys) == 0 {
+		return true
+	}
+	for _, k := range m.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *TerraMerge) appendLists() bool {
+	return m != nil && m.Lists == mergeListsAppend
+}
+
+// mergeMerges merges the merge blocks from a parent to a terrafile.
+// Merge blocks are matched by the block they configure, and child merge blocks
+// override parent merge blocks
+func (t *Terrafile) mergeMerges(parent *Terrafile) {
+	for _, parentMerge := range parent.Merges {
+		if t.merge(parentMerge.Block) == nil {
+			t.Merges = append(t.Merges, parentMerge)
+		}
+	}
+}
+
+// merge returns the merge block for the given block name, or nil
+func (t *Terrafile) merge(block string) *TerraMerge {
+	for _, m := range t.Merges {
+		if m.Block == block {
+			return m
+		}
+	}
+	return nil
+}
+
+// deepMerge merges two values, where the values from override take precedence.
+// Objects and maps are merged recursively and lists are either appended or
+// replaced. Any other values are replaced
+func deepMerge(base cty.Value, override cty.Value, appendLists bool) cty.Value {
+	if base.IsNull() || !base.IsKnown() || override.IsNull() || !override.IsKnown() {
+		return override
+	}
+	baseType, overrideType := base.Type(), override.Type()
+	switch {
+	case isMapping(baseType) && isMapping(overrideType):
+		var merged = base.AsValueMap()
+		if merged == nil {
+			merged = make(map[string]cty.Value)
+		}
+		for key, value := range override.AsValueMap() {
+			if baseValue, ok := merged[key]; ok {
+				merged[key] = deepMerge(baseValue, value, appendLists)
+				continue
+			}
+			merged[key] = value
+		}
+		return cty.ObjectVal(merged)
+	case appendLists && isSequence(baseType) && isSequence(overrideType):
+		var merged = append(base.AsValueSlice(), override.AsValueSlice()...)
+		return cty.TupleVal(merged)
+	default:
+		return override
+	}
+}
+
+func isMapping(ty cty.Type) bool {
+	return ty.IsObjectType() || ty.IsMapType()
+}
+
+func isSequence(ty cty.Type) bool {
+	return ty.IsTupleType() || ty.IsListType()
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Origin records where a setting in a Terrafile was defined
+type Origin struct {
+	// Path is the path of the Terraplate file that defined the setting
+	Path string
+	// Range is the source range of the definition
+	Range hcl.Range
+}
+
+// Origins returns where the setting with the given key was defined, ordered
+// from the nearest Terrafile. The first origin is the effective definition and
+// any others have been overridden (or deep merged).
+// Keys are of the form local.<name>, var.<name>, values.<name>,
+// template.<name>, partial.<name>, merge.<block>, provider.<name>[.<alias>],
+// dependency.<name>, backend, backend.<attribute>, terraform.required_version,
+// terraform.required_providers.<name>, exec.<attribute> and
+// exec.plan.<attribute>
+func (t *Terrafile) Origins(key string) []Origin {
+	return t.origins[key]
+}
+
+// OriginKeys returns the sorted keys of all the settings with an origin
+func (t *Terrafile) OriginKeys() []string {
+	var keys = make([]string, 0, len(t.origins))
+	for key := range t.origins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeOrigins adds the origins from a parent Terrafile after the origins of
+// this Terrafile, so that the nearest definition comes first.
+// The origins of settings that are not inherited are skipped
+func (t *Terrafile) mergeOrigins(parent *Terrafile) {
+	if t.origins == nil {
+		t.origins = make(map[string][]Origin, len(parent.origins))
+	}
+	for key, origins := range parent.origins {
+		if !isInheritedOrigin(key) {
+			continue
+		}
+		t.origins[key] = append(t.origins[key], origins...)
+	}
+}
+
+// combineOrigins adds all the origins from a Terrafile in the same directory
+func (t *Terrafile) combineOrigins(other *Terrafile) {
+	if t.origins == nil {
+		t.origins = make(map[string][]Origin, len(other.origins))
+	}
+	for key, origins := range other.origins {
+		t.origins[key] = append(t.origins[key], origins...)
+	}
+}
+
+// isInheritedOrigin returns whether the setting with the given key is
+// inherited from ancestor Terrafiles. The depends_on attribute and dependency
+// blocks are relative to the Terrafile that declares them, so they are not
+func isInheritedOrigin(key string) bool {
+	return key != "exec.depends_on" && !strings.HasPrefix(key, "dependency.")
+}
+
+// bodyOrigins returns the origins of the settings defined in the body of a
+// Terraplate file
+func bodyOrigins(path string, body *hclsyntax.Body) map[string][]Origin {
+	var origins = make(map[string][]Origin)
+	add := func(key string, rng hcl.Range) {
+		origins[key] = append(origins[key], Origin{
+			Path:  path,
+			Range: rng,
+		})
+	}
+	addAttributes := func(prefix string, attrs hclsyntax.Attributes) {
+		for name, attr := range attrs {
+			add(prefix+name, attr.SrcRange)
+		}
+	}
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "locals":
+			addAttributes(localsNamespace+".", block.Body.Attributes)
+		case "variables":
+			addAttributes(variablesNamespace+".", block.Body.Attributes)
+		case "values":
+			addAttributes(valuesNamespace+".", block.Body.Attributes)
+		case "variable":
+			add(variablesNamespace+"."+block.Labels[0], block.Range())
+		case "template", "partial", "merge", "dependency":
+			add(block.Type+"."+block.Labels[0], block.Range())
+		case "terraform":
+			addAttributes("terraform.", block.Body.Attributes)
+			for _, tfBlock := range block.Body.Blocks {
+				if tfBlock.Type == "required_providers" {
+					addAttributes("terraform.required_providers.", tfBlock.Body.Attributes)
+				}
+			}
+		case "provider":
+			provider := &TerraProvider{Name: block.Labels[0], Body: block.Body}
+			add("provider."+provider.key(), block.Range())
+		case "backend":
+			add("backend", block.Range())
+			addAttributes("backend.", block.Body.Attributes)
+		case "exec":
+			addAttributes("exec.", block.Body.Attributes)
+			for _, execBlock := range block.Body.Blocks {
+				addAttributes("exec."+execBlock.Type+".", execBlock.Body.Attributes)
+			}
+		}
+	}
+	return origins
+}
@@ -16,6 +16,9 @@ func DefaultConfig() *Config {
 
 type Config struct {
 	Chdir string
+	// Exclude contains patterns (using gitignore syntax) of files and
+	// directories to exclude when looking for Terrafiles
+	Exclude []string
 }
 
 func Parse(config *Config) (*TerraConfig, error) {
@@ -33,7 +36,12 @@ func Parse(config *Config) (*TerraConfig, error) {
 		return nil, fmt.Errorf("looking for parent terraplate.hcl files: %w", travErr)
 	}
 
-	terrafiles, walkErr := walkDownDirectory(config.Chdir, ancestor)
+	ignore, ignoreErr := newIgnorer(config.Chdir, config.Exclude)
+	if ignoreErr != nil {
+		return nil, fmt.Errorf("reading ignore files: %w", ignoreErr)
+	}
+
+	terrafiles, walkErr := walkDownDirectory(config.Chdir, ancestor, ignore)
 	if walkErr != nil {
 		return nil, fmt.Errorf("looking for terraplate.hcl files: %w", walkErr)
 	}
@@ -106,6 +114,9 @@ func walkUpDirectory(path string) (*Terrafile, error) {
 	var (
 		skipFirst      = false
 		childTerrafile *Terrafile
+		// nearest is the first terrafile found, which is the direct ancestor
+		// for the terrafiles found when walking down
+		nearest *Terrafile
 	)
 	travErr := TraverseUpDirectory(path, func(dir string) (bool, error) {
 		// Skip the first directory as it will get processed when we walk down
@@ -120,37 +131,28 @@ func walkUpDirectory(path string) (*Terrafile, error) {
 			return false, fmt.Errorf("reading directory \"%s\": %w", dir, readErr)
 		}
 
-		var terrafile *Terrafile
-		// Iterate over files and check if any of them are Terrafiles.
-		// If they are, parse them. If there's multiple, it's an error (for now).
+		var files []string
 		for _, entry := range entries {
 			if !entry.IsDir() && isTerraplateFile(entry.Name()) {
-				// Check that we haven't already detected a terrafile.
-				// Multiple terrafiles are not allowed at this time.
-				if terrafile != nil {
-					return false, fmt.Errorf("multiple terraplate files detected in folder %s", dir)
-				}
-				var (
-					parseErr error
-					path     = filepath.Join(dir, entry.Name())
-				)
-				terrafile, parseErr = parseTerrafile(path)
-				if parseErr != nil {
-					return false, fmt.Errorf("parsing terraplate file %s: %w", path, parseErr)
-				}
+				files = append(files, filepath.Join(dir, entry.Name()))
 			}
 		}
+		// Parse and combine any Terrafiles found in this directory
+		terrafile, parseErr := parseTerrafiles(files)
+		if parseErr != nil {
+			return false, parseErr
+		}
 
 		// If no terrafile was found, just continue traversing up
 		if terrafile == nil {
 			return true, nil
 		}
 		if childTerrafile != nil {
-			// Terrafile is not a root module because it has a child
-			terrafile.IsRoot = false
 			// Create parent/child relationship
-			terrafile.Children = append(terrafile.Children, childTerrafile)
-			childTerrafile.Ancestor = terrafile
+			terrafile.addChild(childTerrafile)
+		}
+		if nearest == nil {
+			nearest = terrafile
 		}
 		// Set current terrafile as the new child terrafile for the next traversal
 		childTerrafile = terrafile
@@ -160,67 +162,57 @@ func walkUpDirectory(path string) (*Terrafile, error) {
 	if travErr != nil {
 		return nil, fmt.Errorf("walking up directories: %w", travErr)
 	}
-	if childTerrafile != nil {
-		rootMods := childTerrafile.rootModules()
-		if len(rootMods) == 1 {
-			return rootMods[0], nil
-		}
-
-		return nil, fmt.Errorf("unexpected: terrafile has more than one root module after walking up directories, total %d", len(rootMods))
-	}
 	// Returning nil is ok. It means we did not find any terrafiles but also did
 	// not encounter an error
-	return nil, nil
+	return nearest, nil
 }
 
-func walkDownDirectory(dir string, ancestor *Terrafile) ([]*Terrafile, error) {
+func walkDownDirectory(dir string, ancestor *Terrafile, ignore *ignorer) ([]*Terrafile, error) {
 	var (
 		terrafiles []*Terrafile
-		terrafile  *Terrafile
 		subDirs    []string
 	)
 
-	// Skip the .terraform directories
-	if filepath.Base(dir) == ".terraform" {
+	// Skip the .terraform directories and any ignored directories
+	if filepath.Base(dir) == ".terraform" || ignore.ignore(dir, true) {
 		return terrafiles, nil
 	}
+	// Ignore files apply to the directory they are in and all subdirectories
+	ignore, ignoreErr := ignore.withIgnoreFile(dir)
+	if ignoreErr != nil {
+		return nil, ignoreErr
+	}
 	entries, readErr := os.ReadDir(dir)
 	if readErr != nil {
 		return nil, fmt.Errorf("reading directory \"%s\": %w", dir, readErr)
 	}
+	var files []string
 	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
 		if entry.IsDir() {
-			subDirs = append(subDirs, filepath.Join(dir, entry.Name()))
+			subDirs = append(subDirs, path)
 			continue
 		}
-		if isTerraplateFile(entry.Name()) {
-			// Check that we haven't already detected a terrafile.
-			// Multiple terrafiles are not allowed at this time.
-			if terrafile != nil {
-				return nil, fmt.Errorf("multiple terraplate files detected in folder %s", dir)
-			}
-			var (
-				parseErr error
-				path     = filepath.Join(dir, entry.Name())
-			)
-			terrafile, parseErr = parseTerrafile(path)
-			if parseErr != nil {
-				return nil, fmt.Errorf("parsing terraplate file %s: %w", path, parseErr)
-			}
-			if ancestor != nil {
-				ancestor.IsRoot = false
-				terrafile.Ancestor = ancestor
-				ancestor.Children = append(ancestor.Children, terrafile)
-			}
-
-			terrafiles = append(terrafiles, terrafile)
+		if isTerraplateFile(entry.Name()) && !ignore.ignore(path, false) {
+			files = append(files, path)
+		}
+	}
+	// Parse and combine any Terrafiles found in this directory
+	terrafile, parseErr := parseTerrafiles(files)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if terrafile != nil {
+		if ancestor != nil {
+			ancestor.addChild(terrafile)
 		}
+		terrafiles = append(terrafiles, terrafile)
 	}
 	if terrafile == nil {
 		terrafile = ancestor
 	}
 	for _, subDir := range subDirs {
-		descFiles, err := walkDownDirectory(subDir, terrafile)
+		descFiles, err := walkDownDirectory(subDir, terrafile, ignore)
 		if err != nil {
 			return nil, err
 		}
@@ -1,10 +1,16 @@
 package parser
 
 import (
+	"errors"
+	"path/filepath"
+	"sort"
 	"testing"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func TestParser(t *testing.T) {
@@ -56,3 +62,789 @@ func TestTemplates(t *testing.T) {
 	})
 	require.NoError(t, err)
 }
+
+func TestMultipleFiles(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/multipleFiles",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	rootMod := config.RootModules()[0]
+	assert.Contains(t, rootMod.Locals(), "key")
+	assert.Contains(t, rootMod.Values(), "key")
+	assert.Contains(t, rootMod.Variables(), "key")
+	assert.Contains(t, rootMod.TerraformBlock.RequiredProviders(), "local")
+
+	// The parent Terrafile should use terraplate.hcl as its path
+	parent := rootMod.Ancestor
+	assert.Equal(t, "terraplate.hcl", filepath.Base(parent.Path))
+	assert.Len(t, parent.Files, 3)
+}
+
+func TestMultipleFilesConflict(t *testing.T) {
+	tests := map[string]struct {
+		dir   string
+		errs  []string
+		lines []int
+	}{
+		"value": {
+			dir:   "testdata/multipleFilesConflict",
+			errs:  []string{"value \"key\" is defined in both"},
+			lines: []int{3},
+		},
+		"variable block": {
+			dir:   "testdata/multipleFilesConflictVariable",
+			errs:  []string{"variable \"region\" is defined in both"},
+			lines: []int{2},
+		},
+		"exec block": {
+			dir:   "testdata/multipleFilesConflictExec",
+			errs:  []string{"block \"exec\" is defined in both"},
+			lines: []int{2},
+		},
+		"multiple": {
+			dir: "testdata/multipleFilesConflictMultiple",
+			errs: []string{
+				"local \"name\" is defined in both",
+				"value \"key\" is defined in both",
+				"value \"zone\" is defined in both",
+			},
+			lines: []int{8, 4, 3},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(&Config{
+				Chdir: tc.dir,
+			})
+			require.Error(t, err)
+
+			// The error should contain a diagnostic pointing at each conflict
+			var diags hcl.Diagnostics
+			require.True(t, errors.As(err, &diags))
+			require.Len(t, diags, len(tc.errs))
+			for i, diag := range diags {
+				assert.Contains(t, diag.Detail, tc.errs[i])
+				require.NotNil(t, diag.Subject)
+				assert.Equal(t, "b.tp.hcl", filepath.Base(diag.Subject.Filename))
+				assert.Equal(t, tc.lines[i], diag.Subject.Start.Line)
+			}
+		})
+	}
+}
+
+func TestTemplateDiagnostics(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/templateDiagnostics",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	tf := config.RootModules()[0]
+	data, err := tf.BuildData()
+	require.NoError(t, err)
+	tmpl := tf.Templates[0]
+	_, condErr := tmpl.Condition(data)
+	require.Error(t, condErr)
+
+	var diags hcl.Diagnostics
+	require.True(t, errors.As(condErr, &diags))
+	require.Len(t, diags, 1)
+	require.NotNil(t, diags[0].Subject)
+	assert.Equal(t, tmpl.DeclRange, *diags[0].Subject)
+	assert.Equal(t, 2, diags[0].Subject.Start.Line)
+}
+
+func TestExpressions(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/expressions",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	rootMod := config.RootModules()[0]
+	assert.Equal(t, cty.StringVal("terraplate-dev-state"), rootMod.Values()["bucket"])
+	assert.Equal(t, cty.StringVal("terraplate-dev-state"), rootMod.Locals()["bucket"])
+	assert.Equal(t, cty.StringVal("dev-eu-west-1"), rootMod.Locals()["name"])
+}
+
+func TestExpressionsCycle(t *testing.T) {
+	_, err := Parse(&Config{
+		Chdir: "testdata/expressionsCycle",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Cycle in references")
+}
+
+func TestDeepMerge(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/deepMerge",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	values, err := config.RootModules()[0].ValuesAsGo()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"project": "terraplate",
+		"owner":   "dev-team",
+		"env":     "dev",
+	}, values["tags"])
+	assert.Equal(t, []interface{}{"eu-west-1", "eu-north-1"}, values["regions"])
+}
+
+func TestRootModule(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/rootModule",
+	})
+	require.NoError(t, err)
+
+	var rootDirs []string
+	for _, tf := range config.RootModules() {
+		rootDirs = append(rootDirs, tf.Dir)
+	}
+	assert.ElementsMatch(t, []string{
+		"testdata/rootModule",
+		"testdata/rootModule/child",
+	}, rootDirs)
+}
+
+func TestIgnore(t *testing.T) {
+	type test struct {
+		chdir    string
+		exclude  []string
+		rootDirs []string
+	}
+	tests := []test{
+		{
+			chdir: "testdata/ignore",
+			rootDirs: []string{
+				"testdata/ignore/a",
+				"testdata/ignore/b/nested",
+				"testdata/ignore/excluded",
+			},
+		},
+		{
+			// Exclude patterns cannot be negated by the ignore files
+			chdir:   "testdata/ignore",
+			exclude: []string{"excluded"},
+			rootDirs: []string{
+				"testdata/ignore/a",
+				"testdata/ignore/b/nested",
+			},
+		},
+		{
+			// The ignore files of ancestors apply when starting in a
+			// subdirectory
+			chdir: "testdata/ignore/b",
+			rootDirs: []string{
+				"testdata/ignore/b/nested",
+			},
+		},
+		{
+			// Exclude patterns are relative to the starting directory, and
+			// cannot be negated by the ignore files of ancestors
+			chdir:   "testdata/ignore/b",
+			exclude: []string{"/nested"},
+			rootDirs: []string{
+				"testdata/ignore/b",
+			},
+		},
+	}
+	for _, tc := range tests {
+		config, err := Parse(&Config{
+			Chdir:   tc.chdir,
+			Exclude: tc.exclude,
+		})
+		require.NoError(t, err)
+
+		var rootDirs []string
+		for _, tf := range config.RootModules() {
+			rootDirs = append(rootDirs, tf.Dir)
+		}
+		assert.ElementsMatch(t, tc.rootDirs, rootDirs)
+	}
+}
+
+func TestVariableBlocks(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/variableBlocks",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	rootMod := config.RootModules()[0]
+	// The "key" variable is inherited from the testdata Terrafile
+	assert.Equal(t, []string{"key", "region", "required"}, rootMod.VariableNames())
+	assert.Equal(t, cty.StringVal("eu-north-1"), rootMod.Variables()["region"])
+	require.NotNil(t, rootMod.VariableBlock("region"))
+	assert.Equal(t, "The region to deploy to", rootMod.VariableBlock("region").Description)
+}
+
+func TestVariableBlocksDuplicate(t *testing.T) {
+	_, err := Parse(&Config{
+		Chdir: "testdata/variableBlocksDuplicate",
+	})
+	require.Error(t, err)
+
+	// The diagnostic points at the duplicate and mentions the first declaration
+	var diags hcl.Diagnostics
+	require.True(t, errors.As(err, &diags))
+	require.Len(t, diags, 1)
+	assert.Equal(t, "Duplicate variable declaration", diags[0].Summary)
+	assert.Contains(t, diags[0].Detail, "terraplate.hcl:2,")
+	require.NotNil(t, diags[0].Subject)
+	assert.Equal(t, 6, diags[0].Subject.Start.Line)
+}
+
+func TestValuesFiles(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/valuesFiles",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	values, err := config.RootModules()[0].ValuesAsGo()
+	require.NoError(t, err)
+	common := map[string]interface{}{
+		"project": "terraplate",
+		"regions": []interface{}{"eu-west-1"},
+	}
+	assert.Equal(t, common, values["common"])
+	assert.Equal(t, common, values["yamlfile"])
+	assert.Equal(t, "dev", values["env"])
+	assert.Equal(t, map[string]interface{}{"instance_count": float64(2)}, values["tfvars"])
+}
+
+func TestFunctions(t *testing.T) {
+	t.Setenv("TERRAPLATE_TEST_ENV", "set")
+	config, err := Parse(&Config{
+		Chdir: "testdata/functions",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	locals, err := config.RootModules()[0].LocalsAsGo()
+	require.NoError(t, err)
+	assert.Equal(t, "TERRAPLATE", locals["upper"])
+	assert.Equal(t, "terraplate-a-b", locals["joined"])
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": float64(2)}, locals["merged"])
+	assert.Equal(t, "value", locals["lookup"])
+	assert.Equal(t, "terraplate-dev", locals["format"])
+	assert.Equal(t, "set", locals["home"])
+	assert.Equal(t, "dev", locals["dir"])
+	assert.Equal(t, float64(4), locals["number"])
+	assert.Equal(t, "true", locals["string"])
+	assert.Equal(t, float64(2), locals["set"])
+	assert.Equal(t, float64(1), locals["index"])
+	assert.Equal(t, float64(0), locals["try"])
+	assert.Equal(t, false, locals["can"])
+	assert.Equal(t, []interface{}{"a", "c"}, locals["diff"])
+	assert.Equal(t, true, locals["starts"])
+	assert.Equal(t, false, locals["ends"])
+	assert.Equal(t, true, locals["all"])
+	assert.Equal(t, false, locals["any"])
+	assert.Equal(t, 6.5, locals["sum"])
+	assert.Equal(t, "only", locals["one"])
+	assert.Nil(t, locals["none"])
+	assert.Equal(t, "terraplate", locals["base64"])
+	assert.Equal(t, true, locals["exists"])
+	assert.Equal(t, false, locals["absent"])
+}
+
+func TestOrigins(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/origins",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	tf := config.RootModules()[0]
+	absWd, err := filepath.Abs(".")
+	require.NoError(t, err)
+	type testCase struct {
+		key   string
+		files []string
+	}
+	tests := []testCase{
+		{
+			key:   "local.key",
+			files: []string{"testdata/origins/child/terraplate.hcl", "testdata/origins/terraplate.hcl", "testdata/terraplate.hcl"},
+		},
+		{
+			key:   "template.main",
+			files: []string{"testdata/origins/terraplate.hcl"},
+		},
+		{
+			key:   "exec.plan.out",
+			files: []string{"testdata/origins/child/terraplate.hcl", "testdata/terraplate.hcl"},
+		},
+		{
+			key:   "exec.skip",
+			files: []string{"testdata/terraplate.hcl"},
+		},
+		// Neither depends_on nor dependencies are inherited
+		{
+			key: "exec.depends_on",
+		},
+		{
+			key: "dependency.network",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.key, func(t *testing.T) {
+			var files []string
+			for _, origin := range tf.Origins(tc.key) {
+				// Ancestors found when walking up have absolute paths
+				absPath, absErr := filepath.Abs(origin.Path)
+				require.NoError(t, absErr)
+				relPath, relErr := filepath.Rel(absWd, absPath)
+				require.NoError(t, relErr)
+				files = append(files, relPath)
+				assert.Equal(t, origin.Path, origin.Range.Filename)
+			}
+			assert.Equal(t, tc.files, files)
+		})
+	}
+
+	// The parent records the origins of its own depends_on and dependencies
+	for _, parent := range config.Terrafiles {
+		if parent.Dir != "testdata/origins" {
+			continue
+		}
+		assert.Len(t, parent.Origins("exec.depends_on"), 1)
+		assert.Len(t, parent.Origins("dependency.network"), 1)
+		return
+	}
+	t.Fatal("parent Terrafile not found")
+}
+
+func TestBackend(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/backend",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 2)
+
+	expected := map[string]map[string]cty.Value{
+		"a": {
+			"bucket": cty.StringVal("bucket-name"),
+			"key":    cty.StringVal("backend/a/terraform.tfstate"),
+			"region": cty.StringVal("eu-west-1"),
+		},
+		"b": {
+			"bucket": cty.StringVal("bucket-name"),
+			"key":    cty.StringVal("custom.tfstate"),
+		},
+	}
+	for _, tf := range config.RootModules() {
+		require.NotNil(t, tf.BackendBlock)
+		assert.Equal(t, "s3", tf.BackendBlock.Type)
+		assert.Equal(t, expected[filepath.Base(tf.Dir)], tf.BackendBlock.Config)
+	}
+}
+
+func TestBackendConflict(t *testing.T) {
+	_, err := Parse(&Config{
+		Chdir: "testdata/backendConflict",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would use the same state")
+	// Relative local paths are resolved against each root module
+	assert.Contains(t, err.Error(), "testdata/backendConflict/a/terraplate.hcl and testdata/backendConflict/b/terraplate.hcl")
+	// Attributes that do not identify the state are ignored
+	assert.Contains(t, err.Error(), "testdata/backendConflict/c/terraplate.hcl and testdata/backendConflict/d/terraplate.hcl")
+
+	// Local states in each root module, different keys and keys given when
+	// initialising do not conflict
+	config, err := Parse(&Config{
+		Chdir: "testdata/backendNoConflict",
+	})
+	require.NoError(t, err)
+	assert.Len(t, config.RootModules(), 7)
+}
+
+func TestProviders(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/providers",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	file := hclwrite.NewEmptyFile()
+	for _, provider := range config.RootModules()[0].Providers {
+		for _, block := range provider.Blocks {
+			file.Body().AppendBlock(block)
+		}
+	}
+	expected := `provider "aws" {
+  profile = var.profile
+  region  = "eu-central-1"
+}
+provider "aws" {
+  alias  = "eu-west-1"
+  region = "eu-west-1"
+}
+provider "aws" {
+  alias  = "us-east-1"
+  region = "us-east-1"
+}
+`
+	assert.Equal(t, expected, string(hclwrite.Format(file.Bytes())))
+}
+
+func TestRequiredProviders(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/requiredProviders",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	tfBlock := config.RootModules()[0].TerraformBlock
+	expected := map[string]RequiredProvider{
+		"aws": {
+			Source:               "hashicorp/aws",
+			Version:              ">= 4.0.0",
+			ConfigurationAliases: []string{"aws.west"},
+		},
+		"random": {
+			Version: "3.1.0",
+		},
+		// Inherited from testdata/terraplate.hcl
+		"local": {
+			Source:  "hashicorp/local",
+			Version: "2.1.0",
+		},
+	}
+	assert.Equal(t, expected, tfBlock.RequiredProviders())
+	require.NotNil(t, tfBlock.CloudBlock)
+	assert.Equal(t, "cloud {\n  organization = \"org\"\n}\n", string(hclwrite.Format(tfBlock.CloudBlock.Block.BuildTokens(nil).Bytes())))
+	require.Len(t, tfBlock.ProviderMetas, 1)
+	assert.Equal(t, "aws", tfBlock.ProviderMetas[0].Name)
+}
+
+func TestExecEnv(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/execEnv",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	expected := map[string]string{
+		"AWS_PROFILE":  "dev",
+		"TF_VAR_name":  "dev",
+		"TF_LOG_LEVEL": "1",
+	}
+	assert.Equal(t, expected, config.RootModules()[0].ExecBlock.Env)
+	// Other settings in the exec block should still be inherited
+	assert.True(t, config.RootModules()[0].ExecBlock.Skip)
+	assert.Equal(t, "tofu", config.RootModules()[0].ExecBlock.Binary)
+}
+
+func TestDependsOn(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/dependsOn",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 2)
+
+	var dependsOn = make(map[string][]string)
+	for _, tf := range config.RootModules() {
+		var deps = make([]string, 0)
+		for _, dep := range tf.DependsOn() {
+			deps = append(deps, filepath.Base(dep.Dir))
+		}
+		dependsOn[filepath.Base(tf.Dir)] = deps
+	}
+	expected := map[string][]string{
+		"app":     {"network"},
+		"network": {},
+	}
+	assert.Equal(t, expected, dependsOn)
+}
+
+func TestDependsOnCycle(t *testing.T) {
+	_, err := Parse(&Config{
+		Chdir: "testdata/dependsOnCycle",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle in dependencies: testdata/dependsOnCycle/a -> testdata/dependsOnCycle/b -> testdata/dependsOnCycle/a")
+}
+
+func TestDependsOnDestroy(t *testing.T) {
+	_, err := Parse(&Config{
+		Chdir: "testdata/dependsOnDestroy",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "terrafile testdata/dependsOnDestroy/network/terraplate.hcl: -destroy in extra_args")
+}
+
+func TestDependency(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/dependency",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 2)
+
+	var app, network *Terrafile
+	for _, tf := range config.RootModules() {
+		switch filepath.Base(tf.Dir) {
+		case "app":
+			app = tf
+		case "network":
+			network = tf
+		}
+	}
+	require.NotNil(t, app)
+	require.NotNil(t, network)
+	require.Len(t, app.Dependencies, 1)
+	dep := app.Dependencies[0]
+	assert.Equal(t, filepath.Join("testdata", "dependency", "network"), dep.Dir)
+	assert.Equal(t, network, dep.Module())
+	assert.False(t, dep.MockOutputsAllowedOnApply)
+	// A dependency block also means the root module depends on the other
+	assert.Equal(t, []*Terrafile{network}, app.DependsOn())
+
+	// Mock outputs are used until the outputs have been read
+	data, err := app.BuildData()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"network": map[string]interface{}{
+			"vpc_id":  "vpc-mock",
+			"subnets": []interface{}{"subnet-a", "subnet-b"},
+		},
+	}, data.Dependencies)
+
+	dep.Outputs = map[string]interface{}{"vpc_id": "vpc-123"}
+	data, err = app.BuildData()
+	require.NoError(t, err)
+	contents, err := ExecTemplate(data, "test", "{{ .Dependencies.network.vpc_id }}")
+	require.NoError(t, err)
+	assert.Equal(t, "vpc-123", contents.String())
+}
+
+func TestTemplateForEach(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/templateForEach",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	tf := config.RootModules()[0]
+	data, err := tf.BuildData()
+	require.NoError(t, err)
+
+	var files = make(map[string]string)
+	for _, tmpl := range tf.Templates {
+		for _, eachData := range tmpl.EachData(data) {
+			target, err := tmpl.TargetPath(eachData)
+			require.NoError(t, err)
+			contents, err := ExecTemplate(eachData, tmpl.Name, tmpl.Contents)
+			require.NoError(t, err)
+			files[target] = contents.String()
+		}
+	}
+	expected := map[string]string{
+		"team_data.tp.tf":       "data = data@example.com",
+		"team_platform.tp.tf":   "platform = platform@example.com",
+		"regions/eu-west-1.txt": "eu-west-1",
+		"regions/us-east-1.txt": "us-east-1",
+	}
+	assert.Equal(t, expected, files)
+}
+
+func TestExclude(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/exclude",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 2)
+
+	enabledTemplates := func(tf *Terrafile) []string {
+		var names = make([]string, 0)
+		for _, tmpl := range tf.Templates {
+			if tmpl.IsEnabled() {
+				names = append(names, tmpl.Name)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	for _, tf := range config.RootModules() {
+		switch filepath.Base(tf.Dir) {
+		case "disabled":
+			assert.Equal(t, []string{"backend"}, enabledTemplates(tf))
+			assert.Equal(t, []string{"key", "v1", "v2"}, tf.VariableNames())
+		case "nested":
+			assert.Equal(t, []string{"providers"}, enabledTemplates(tf))
+			assert.Equal(t, []string{"key", "v1"}, tf.VariableNames())
+			assert.Equal(t, map[string]cty.Value{
+				"key": cty.StringVal("value"),
+				"a":   cty.StringVal("a"),
+				"c":   cty.StringVal("c"),
+			}, tf.Locals())
+			assert.Equal(t, map[string]cty.Value{
+				"key": cty.StringVal("value"),
+				"x":   cty.StringVal("x"),
+			}, tf.Values())
+			assert.Empty(t, tf.Origins("local.b"))
+		default:
+			t.Fatalf("unexpected root module %s", tf.Dir)
+		}
+	}
+}
+
+func TestPartials(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/partials",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	tf := config.RootModules()[0]
+	require.Len(t, tf.Templates, 1)
+	data, err := tf.BuildData()
+	require.NoError(t, err)
+	contents, err := ExecTemplate(data, tf.Templates[0].Name, tf.Templates[0].Contents)
+	require.NoError(t, err)
+	assert.Equal(t, "tags = { project = \"terraplate\", env = \"dev\" }\n", contents.String())
+
+	// A template can use a partial with the same name
+	contents, err = ExecTemplate(data, "name", "name = \"{{ template \"name\" . }}\"")
+	require.NoError(t, err)
+	assert.Equal(t, "name = \"terraplate\"", contents.String())
+}
+
+func TestBuildBlock(t *testing.T) {
+	config, err := Parse(&Config{
+		Chdir: "testdata/build",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.RootModules(), 1)
+
+	tf := config.RootModules()[0]
+	require.NotNil(t, tf.BuildBlock)
+	require.NotNil(t, tf.BuildBlock.Header)
+	assert.Equal(t, "Managed by the child", *tf.BuildBlock.Header)
+	assert.Equal(t, "_comment", tf.BuildBlock.JSONHeaderKey)
+
+	var headers = make(map[string]*string)
+	for _, tmpl := range tf.Templates {
+		headers[tmpl.Name] = tmpl.Header
+	}
+	require.Contains(t, headers, "config")
+	assert.Nil(t, headers["config"])
+	require.NotNil(t, headers["main"])
+	assert.Equal(t, "", *headers["main"])
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	data := &BuildData{
+		Values: map[string]interface{}{
+			"name":  "my \"app\" ${env}",
+			"count": float64(2),
+			"tags": map[string]interface{}{
+				"project": "terraplate",
+				"owners":  []interface{}{"a", "b"},
+			},
+		},
+	}
+	tests := map[string]struct {
+		text     string
+		expected string
+	}{
+		"toHcl": {
+			text:     `tags = {{ toHcl .Values.tags }}`,
+			expected: "tags = {\n  owners  = [\"a\", \"b\"]\n  project = \"terraplate\"\n}",
+		},
+		"toHclBlock": {
+			text:     `{{ toHclBlock "module" "app" .Values.tags }}`,
+			expected: "module \"app\" {\n  owners  = [\"a\", \"b\"]\n  project = \"terraplate\"\n}",
+		},
+		"hclQuote": {
+			text:     `name = {{ hclQuote .Values.name }}`,
+			expected: `name = "my \"app\" $${env}"`,
+		},
+		"tfvars": {
+			text:     `{{ tfvars .Values }}`,
+			expected: "count = 2\nname  = \"my \\\"app\\\" $${env}\"\ntags = {\n  owners  = [\"a\", \"b\"]\n  project = \"terraplate\"\n}\n",
+		},
+		"indentHcl": {
+			text:     "module \"app\" {\n  tags = {{ toHcl .Values.tags | indentHcl 2 }}\n}",
+			expected: "module \"app\" {\n  tags = {\n    owners  = [\"a\", \"b\"]\n    project = \"terraplate\"\n  }\n}",
+		},
+		"toYaml": {
+			text:     `{{ toYaml .Values.tags }}`,
+			expected: "\"owners\":\n- \"a\"\n- \"b\"\n\"project\": \"terraplate\"",
+		},
+		"toJsonPretty": {
+			text:     `{{ toJsonPretty .Values.tags }}`,
+			expected: "{\n  \"owners\": [\n    \"a\",\n    \"b\"\n  ],\n  \"project\": \"terraplate\"\n}",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			contents, err := ExecTemplate(data, name, test.text)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, contents.String())
+		})
+	}
+}
+
+func TestFormatContents(t *testing.T) {
+	tests := map[string]struct {
+		contents string
+		expected string
+		isErr    bool
+	}{
+		"main.tf": {
+			contents: "locals {\na=1\nbb = 2\n}\n",
+			expected: "locals {\n  a  = 1\n  bb = 2\n}\n",
+		},
+		"invalid.hcl": {
+			contents: "locals {\na = \n",
+			isErr:    true,
+		},
+		"config.json": {
+			contents: `{"a": [1, 2], "b": {}}`,
+			expected: "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}\n",
+		},
+		"invalid.json": {
+			contents: `{"a": 1,}`,
+			isErr:    true,
+		},
+		"config.yaml": {
+			contents: "# comment\na:  1\n",
+			expected: "# comment\na:  1\n",
+		},
+		"invalid.yml": {
+			contents: "a: [1\n",
+			isErr:    true,
+		},
+		"manifests.yaml": {
+			contents: "---\na: 1\n---\n# comment\nb: 2\n",
+			expected: "---\na: 1\n---\n# comment\nb: 2\n",
+		},
+		"invalid-manifests.yaml": {
+			contents: "a: 1\n---\nb: [2\n",
+			isErr:    true,
+		},
+		"README.md": {
+			contents: "# {not hcl\n",
+			expected: "# {not hcl\n",
+		},
+	}
+	for target, tc := range tests {
+		t.Run(target, func(t *testing.T) {
+			actual, err := formatContents(target, []byte(tc.contents))
+			if tc.isErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), target)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"fmt"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// TerraPartial defines the partial{} block within a Terrafile, which is a
+// named Go template that can be used from any template with
+// {{ template "name" . }}.
+// Partials are inherited and a child can override a partial by using the
+// same name
+type TerraPartial struct {
+	Name     string `hcl:",label"`
+	Contents string `hcl:"contents,attr"`
+	// DeclRange is the range of the partial block in the Terrafile
+	DeclRange hcl.Range
+}
+
+// mergePartials merges the partials from a parent to a terrafile, where child
+// partials override parent partials with the same name
+func (t *Terrafile) mergePartials(parent *Terrafile) {
+	for _, parentPartial := range parent.Partials {
+		if t.partial(parentPartial.Name) == nil {
+			t.Partials = append(t.Partials, parentPartial)
+		}
+	}
+}
+
+// partial returns the partial with the given name, or nil
+func (t *Terrafile) partial(name string) *TerraPartial {
+	for _, p := range t.Partials {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// addPartials defines the partials of the terrafile in the Go template, so
+// that they can be used with {{ template "name" . }}
+func addPartials(tmpl *template.Template, tf *Terrafile) error {
+	if tf == nil {
+		return nil
+	}
+	for _, p := range tf.Partials {
+		if _, parseErr := tmpl.New(p.Name).Parse(p.Contents); parseErr != nil {
+			return fmt.Errorf("parsing partial \"%s\": %w", p.Name, parseErr)
+		}
+	}
+	return nil
+}
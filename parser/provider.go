@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	providerAliasAttr   = "alias"
+	providerForEachAttr = "for_each"
+)
+
+// TerraProvider defines the provider{} block within a Terrafile, which is built
+// into a Terraform provider block in the terraplate.tf file.
+// Blocks contains the provider blocks to build once the Terrafile has been
+// resolved, with one aliased provider for each element of the for_each
+type TerraProvider struct {
+	Name string   `hcl:",label"`
+	Body hcl.Body `hcl:",remain"`
+	// DeclRange is the range of the provider block in the Terrafile
+	DeclRange hcl.Range
+	Blocks    []*hclwrite.Block
+}
+
+// key returns the name and alias of the provider, which identifies a provider
+// when merging. If the alias is not a static string, e.g. each.key, the
+// reference is used instead
+func (p *TerraProvider) key() string {
+	attr, ok := syntaxBody(p.Body).Attributes[providerAliasAttr]
+	if !ok {
+		return p.Name
+	}
+	if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && value.IsKnown() && !value.IsNull() {
+		return p.Name + "." + value.AsString()
+	}
+	if traversal, diags := hcl.AbsTraversalForExpr(attr.Expr); !diags.HasErrors() {
+		return p.Name + "." + traversalString(traversal)
+	}
+	// Otherwise the provider can only be identified by where it is defined
+	return p.Name + "." + attr.Expr.Range().String()
+}
+
+// mergeProviders merges the provider{} blocks from a parent to a terrafile.
+// Providers are matched by name and alias, and child attributes override
+// parent attributes by name. Providers from the parent that do not match are
+// added
+func (t *Terrafile) mergeProviders(parent *Terrafile) {
+	var providers = make([]*TerraProvider, 0, len(t.Providers)+len(parent.Providers))
+	for _, provider := range t.Providers {
+		merged := *provider
+		if parentProvider := parent.provider(provider.key()); parentProvider != nil {
+			merged.Body = mergeBodies(syntaxBody(provider.Body), syntaxBody(parentProvider.Body))
+		}
+		providers = append(providers, &merged)
+	}
+	for _, parentProvider := range parent.Providers {
+		if t.provider(parentProvider.key()) == nil {
+			provider := *parentProvider
+			providers = append(providers, &provider)
+		}
+	}
+	t.Providers = providers
+}
+
+// provider returns the provider{} block with the given key, or nil
+func (t *Terrafile) provider(key string) *TerraProvider {
+	for _, provider := range t.Providers {
+		if provider.key() == key {
+			return provider
+		}
+	}
+	return nil
+}
+
+// resolveProviders creates the provider blocks to build, expanding any
+// for_each
+func (t *Terrafile) resolveProviders(r *resolver) error {
+	var diags hcl.Diagnostics
+	// Sort the providers by name to avoid lots of changes each time
+	sort.SliceStable(t.Providers, func(i, j int) bool {
+		return t.Providers[i].Name < t.Providers[j].Name
+	})
+	for _, provider := range t.Providers {
+		provider.Blocks = nil
+		var (
+			body = syntaxBody(provider.Body)
+			ctx  = r.evalCtx(filepath.Dir(provider.DeclRange.Filename))
+		)
+		forEach, ok := body.Attributes[providerForEachAttr]
+		if !ok {
+			block := hclwrite.NewBlock("provider", []string{provider.Name})
+			diags = append(diags, newBodyRenderer(ctx).render(block.Body(), body)...)
+			provider.Blocks = append(provider.Blocks, block)
+			continue
+		}
+		each, eachDiags := forEachValues(forEach.Expr, ctx)
+		diags = append(diags, eachDiags...)
+		if eachDiags.HasErrors() {
+			continue
+		}
+		if _, ok := body.Attributes[providerAliasAttr]; !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing provider alias",
+				Detail:   fmt.Sprintf("Provider \"%s\" uses for_each, so it must set an alias, e.g. each.key.", provider.Name),
+				Subject:  provider.DeclRange.Ptr(),
+			})
+			continue
+		}
+		for _, key := range sortedValueKeys(each) {
+			eachCtx := ctx.NewChild()
+			eachCtx.Variables = map[string]cty.Value{
+				eachNamespace: cty.ObjectVal(map[string]cty.Value{
+					"key":   cty.StringVal(key),
+					"value": each[key],
+				}),
+			}
+			block := hclwrite.NewBlock("provider", []string{provider.Name})
+			diags = append(diags, newBodyRenderer(eachCtx).render(block.Body(), body, providerForEachAttr)...)
+			provider.Blocks = append(provider.Blocks, block)
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
+// forEachValues evaluates a for_each expression, which can be a map or object,
+// or a list or set of strings. It returns the each.value for each each.key
+func forEachValues(expr hcl.Expression, ctx *hcl.EvalContext) (map[string]cty.Value, hcl.Diagnostics) {
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	invalidDiags := func(detail string) hcl.Diagnostics {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid for_each argument",
+			Detail:   detail,
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+	if value.IsNull() || !value.IsWhollyKnown() {
+		return nil, invalidDiags("The for_each argument must be known and not null.")
+	}
+	var (
+		ty     = value.Type()
+		values = make(map[string]cty.Value)
+	)
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		for key, elem := range value.AsValueMap() {
+			values[key] = elem
+		}
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		for _, elem := range value.AsValueSlice() {
+			if elem.Type() != cty.String || elem.IsNull() {
+				return nil, invalidDiags("The for_each argument must be a map, or a list or set of strings.")
+			}
+			values[elem.AsString()] = elem
+		}
+	default:
+		return nil, invalidDiags("The for_each argument must be a map, or a list or set of strings.")
+	}
+	return values, diags
+}
+
+// sortedValueKeys returns the keys of a map of values sorted alphabetically
+func sortedValueKeys(values map[string]cty.Value) []string {
+	var keys = make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Namespaces that can be referenced from expressions within a Terrafile,
+// e.g. local.name, var.region or values.env
+const (
+	localsNamespace    = "local"
+	variablesNamespace = "var"
+	valuesNamespace    = "values"
+)
+
+// resolve evaluates the locals, variables, values, templates, backend,
+// providers, terraform block and exec block of a Terrafile.
+// Expressions are not evaluated when parsing, so resolve should be called after
+// the Terrafile has been merged with its ancestors, as the expressions can
+// reference anything that was inherited. The locals, variables and values are
+// resolved first, as the other settings can reference them. Inherited settings
+// are shared with ancestors, so they are copied before being resolved for a
+// root module
+func (t *Terrafile) resolve() error {
+	r := newResolver(map[string]hcl.Attributes{
+		localsNamespace:    t.localsAttributes(),
+		variablesNamespace: t.variablesAttributes(),
+		valuesNamespace:    t.valuesAttributes(),
+	})
+	if t.LocalsBlock != nil {
+		r.overridden[localsNamespace] = t.LocalsBlock.Overridden
+	}
+	if t.VariablesBlock != nil {
+		r.overridden[variablesNamespace] = t.VariablesBlock.Overridden
+	}
+	if t.ValuesBlock != nil {
+		r.overridden[valuesNamespace] = t.ValuesBlock.Overridden
+	}
+	r.funcs = terrafileFuncs(t)
+	r.merges[localsNamespace] = t.merge("locals")
+	r.merges[variablesNamespace] = t.merge("variables")
+	r.merges[valuesNamespace] = t.merge("values")
+	if diags := r.resolveAll(); diags.HasErrors() {
+		return diags
+	}
+
+	if t.LocalsBlock == nil {
+		t.LocalsBlock = &TerraLocals{}
+	}
+	t.LocalsBlock.Locals = r.values[localsNamespace]
+	if t.VariablesBlock == nil {
+		t.VariablesBlock = &TerraVariables{}
+	}
+	t.VariablesBlock.Variables = r.values[variablesNamespace]
+	if t.ValuesBlock == nil {
+		t.ValuesBlock = &TerraValues{}
+	}
+	t.ValuesBlock.Values = r.values[valuesNamespace]
+
+	if err := t.resolveTemplates(r); err != nil {
+		return err
+	}
+	if err := t.resolveBackend(r); err != nil {
+		return err
+	}
+	if err := t.resolveProviders(r); err != nil {
+		return err
+	}
+	if err := t.resolveTerraformBlock(r); err != nil {
+		return err
+	}
+	if err := t.resolveExecBlock(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+func newResolver(attrs map[string]hcl.Attributes) *resolver {
+	var values = make(map[string]map[string]cty.Value, len(attrs))
+	for ns := range attrs {
+		values[ns] = make(map[string]cty.Value)
+	}
+	return &resolver{
+		attrs:      attrs,
+		overridden: make(map[string]map[string][]*hcl.Attribute),
+		merges:     make(map[string]*TerraMerge),
+		values:     values,
+	}
+}
+
+// resolver evaluates attributes across namespaces that can reference each
+// other, evaluating the references first
+type resolver struct {
+	// attrs contains the unevaluated attributes for each namespace
+	attrs map[string]hcl.Attributes
+	// overridden contains the overridden ancestor attributes for each namespace
+	overridden map[string]map[string][]*hcl.Attribute
+	// merges contains the merge configuration for each namespace
+	merges map[string]*TerraMerge
+	// values contains the evaluated attributes for each namespace
+	values map[string]map[string]cty.Value
+	// funcs contains additional functions to add to the EvalContext
+	funcs map[string]function.Function
+	// stack contains the references that are currently being resolved and is
+	// used to detect cycles
+	stack []string
+}
+
+func (r *resolver) resolveAll() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, ns := range []string{localsNamespace, variablesNamespace, valuesNamespace} {
+		for _, name := range sortedAttributeNames(r.attrs[ns]) {
+			diags = append(diags, r.resolve(ns, name)...)
+		}
+	}
+	return diags
+}
+
+func (r *resolver) resolve(ns string, name string) hcl.Diagnostics {
+	// Check if it has already been resolved
+	if _, ok := r.values[ns][name]; ok {
+		return nil
+	}
+	var (
+		diags hcl.Diagnostics
+		attr  = r.attrs[ns][name]
+		ref   = ns + "." + name
+	)
+	for index, stackRef := range r.stack {
+		if stackRef == ref {
+			cycle := append(append([]string{}, r.stack[index:]...), ref)
+			return diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Cycle in references",
+				Detail:   fmt.Sprintf("The value of %s depends on itself: %s.", ref, strings.Join(cycle, " -> ")),
+				Subject:  attr.Range.Ptr(),
+			})
+		}
+	}
+	r.stack = append(r.stack, ref)
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+
+	// If deep merging, the overridden ancestor attributes are also needed
+	var (
+		merge       = r.merges[ns]
+		definitions = []*hcl.Attribute{attr}
+	)
+	if merge.isDeep(name) {
+		definitions = append(definitions, r.overridden[ns][name]...)
+	}
+
+	// Resolve the references in the expressions first
+	for _, def := range definitions {
+		diags = append(diags, r.resolveReferences(def.Expr)...)
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	// Evaluate the definitions starting from the furthest ancestor, merging
+	// each value on top of the previous one
+	var value cty.Value
+	for index := len(definitions) - 1; index >= 0; index-- {
+		def := definitions[index]
+		defValue, valueDiags := def.Expr.Value(r.evalCtx(filepath.Dir(def.Range.Filename)))
+		diags = append(diags, valueDiags...)
+		if diags.HasErrors() {
+			return diags
+		}
+		if index == len(definitions)-1 {
+			value = defValue
+			continue
+		}
+		value = deepMerge(value, defValue, merge.appendLists())
+	}
+	r.values[ns][name] = value
+	return diags
+}
+
+// resolveReferences resolves any references in the given expression
+func (r *resolver) resolveReferences(expr hcl.Expression) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, traversal := range expr.Variables() {
+		depNS := traversal.RootName()
+		depAttrs, ok := r.attrs[depNS]
+		if !ok {
+			// Not a namespace we know about, so let the evaluation produce a
+			// meaningful error
+			continue
+		}
+		// If a whole namespace is referenced, it depends on everything within
+		// the namespace
+		depNames := sortedAttributeNames(depAttrs)
+		if len(traversal) > 1 {
+			if depName, ok := traverserName(traversal[1]); ok {
+				depNames = []string{depName}
+			}
+		}
+		for _, depName := range depNames {
+			if _, exists := depAttrs[depName]; !exists {
+				continue
+			}
+			diags = append(diags, r.resolve(depNS, depName)...)
+		}
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+	return diags
+}
+
+// evalCtx returns an EvalContext for evaluating expressions defined in the
+// given directory, containing the values that have been resolved so far
+func (r *resolver) evalCtx(dir string) *hcl.EvalContext {
+	ctx := evalCtx(dir)
+	for name, fn := range r.funcs {
+		ctx.Functions[name] = fn
+	}
+	ctx.Variables = make(map[string]cty.Value, len(r.values))
+	for ns, values := range r.values {
+		ctx.Variables[ns] = cty.ObjectVal(values)
+	}
+	return ctx
+}
+
+// traverserName returns the name of the attribute for a traversal step, such
+// as local.name or local["name"]
+func traverserName(traverser hcl.Traverser) (string, bool) {
+	switch step := traverser.(type) {
+	case hcl.TraverseAttr:
+		return step.Name, true
+	case hcl.TraverseIndex:
+		if step.Key.Type() == cty.String && step.Key.IsKnown() && !step.Key.IsNull() {
+			return step.Key.AsString(), true
+		}
+	}
+	return "", false
+}
+
+func sortedAttributeNames(attrs hcl.Attributes) []string {
+	var names = make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,28 +2,60 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
-	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
-	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/hcl/v2"
 )
 
 // TerraTemplate defines the template{} block within a Terrafile
 type TerraTemplate struct {
-	Name     string `hcl:",label"`
-	Contents string `hcl:"contents,attr"`
-	// Target defines the target file to generate.
-	// Defaults to the Name of the template with a ".tp.tf" extension
+	Name string `hcl:",label"`
+	// Contents is required, unless the template is disabled
+	Contents string `hcl:"contents,optional"`
+	// Target defines the target file to generate and can include Go templates.
+	// Defaults to the Name of the template with a ".tp.tf" extension, or with
+	// the key of each element if using for_each
 	Target string `hcl:"target,optional"`
 	// ConditionAttr defines a string boolean that specifies whether this template
 	// should be built or not.
 	// The string can include Go templates, which means you can have dynamic
 	// behaviour based on the Terrafile
 	ConditionAttr string `hcl:"condition,optional"`
+	// Enabled can be set to false to disable a template inherited from an
+	// ancestor, which is then not built. Defaults to true
+	Enabled *bool `hcl:"enabled,optional"`
+	// Header overrides the header of the generated file set by the build{}
+	// block, and can include Go templates. An empty string disables the header
+	Header *string `hcl:"header,optional"`
+	// Format can be set to false to write the generated file as it is, without
+	// validating and formatting it based on its extension. Defaults to true
+	Format *bool `hcl:"format,optional"`
+	// ForEach builds the template once for each element of a map, or list or
+	// set of strings, available to the Go templates as .Each.Key and
+	// .Each.Value
+	ForEach *hcl.Attribute `hcl:"for_each,optional"`
+	// Each contains the elements of the for_each, converted to Go values
+	Each map[string]interface{}
+	// DeclRange is the range of the template block in the Terrafile, which is
+	// used to report errors when building the template
+	DeclRange hcl.Range
+}
+
+// IsEnabled returns false if the template has been disabled
+func (t TerraTemplate) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// ShouldFormat returns false if formatting has been disabled for the template
+func (t TerraTemplate) ShouldFormat() bool {
+	return t.Format == nil || *t.Format
 }
 
 // Condition resolves the condition attribute to a boolean, or error.
@@ -37,45 +69,105 @@ func (t TerraTemplate) Condition(data *BuildData) (bool, error) {
 	// First tempalte it
 	contents, execErr := ExecTemplate(data, "condition", t.ConditionAttr)
 	if execErr != nil {
-		return false, fmt.Errorf("templating condition for template %s: %w", t.Name, execErr)
+		return false, t.Diagnostics("Invalid template condition", fmt.Errorf("templating condition for template %s: %w", t.Name, execErr))
 	}
 	condition, parseErr := strconv.ParseBool(contents.String())
 	if parseErr != nil {
-		return false, fmt.Errorf("converting condition string to bool for template %s: %w", t.Name, parseErr)
+		return false, t.Diagnostics("Invalid template condition", fmt.Errorf("converting condition string to bool for template %s: %w", t.Name, parseErr))
 	}
 	return condition, nil
 }
 
-func TemplateWrite(buildData *BuildData, name string, text string, target string) error {
-	rawContents, execErr := ExecTemplate(buildData, name, text)
+// EachData returns the build data for each element of the for_each, sorted by
+// key, or only the given build data if the template does not use for_each
+func (t TerraTemplate) EachData(data *BuildData) []*BuildData {
+	if t.ForEach == nil {
+		return []*BuildData{data}
+	}
+	var keys = make([]string, 0, len(t.Each))
+	for key := range t.Each {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var eachData = make([]*BuildData, 0, len(keys))
+	for _, key := range keys {
+		keyData := *data
+		keyData.Each = &EachData{
+			Key:   key,
+			Value: t.Each[key],
+		}
+		eachData = append(eachData, &keyData)
+	}
+	return eachData
+}
+
+// TargetPath executes the target of the template, which can include Go
+// templates, e.g. to use .Each.Key
+func (t TerraTemplate) TargetPath(data *BuildData) (string, error) {
+	contents, execErr := ExecTemplate(data, "target", t.Target)
 	if execErr != nil {
-		return execErr
+		return "", t.Diagnostics("Invalid template target", fmt.Errorf("templating target for template %s: %w", t.Name, execErr))
 	}
+	return contents.String(), nil
+}
 
-	var formattedContents []byte
-	if strings.HasSuffix(target, ".tf") {
-		// Format the contents to make it nice HCL
-		formattedContents = hclwrite.Format(rawContents.Bytes())
-	} else {
-		formattedContents = rawContents.Bytes()
+// Diagnostics returns an error as diagnostics with the range of the template
+// block, so that errors from Go templates can be traced back to the Terrafile.
+// If the error already contains diagnostics, they are returned as they are
+func (t TerraTemplate) Diagnostics(summary string, err error) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if errors.As(err, &diags) {
+		return diags
 	}
+	return diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   err.Error(),
+		Subject:  t.DeclRange.Ptr(),
+	})
+}
 
+// WriteTarget writes the contents generated by a template to the target. If
+// format is true, the contents are validated and formatted based on the
+// extension of the target
+func WriteTarget(target string, contents []byte, format bool) error {
+	if format {
+		var formatErr error
+		contents, formatErr = formatContents(target, contents)
+		if formatErr != nil {
+			return formatErr
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("creating directory for file %s: %w", target, err)
+	}
 	file, createErr := os.Create(target)
 	if createErr != nil {
 		return fmt.Errorf("creating file %s: %w", target, createErr)
 	}
 	defer file.Close()
-	if _, writeErr := file.Write(formattedContents); writeErr != nil {
+	if _, writeErr := file.Write(contents); writeErr != nil {
 		return fmt.Errorf("writing file %s: %w", target, writeErr)
 	}
 	return nil
 }
 
+// ExecTemplate executes the Go template text with the build data. The partials
+// of the Terrafile being built can be used from the template
 func ExecTemplate(buildData *BuildData, name string, text string) (*bytes.Buffer, error) {
+	// Partials share the namespace of the template, so make sure a partial
+	// with the same name does not replace the template
+	if buildData.Terrafile != nil && buildData.Terrafile.partial(name) != nil {
+		name = "template." + name
+	}
 	tmpl, tmplErr := commonTemplate(name).Parse(text)
 	if tmplErr != nil {
 		return nil, tmplErr
 	}
+	if err := addPartials(tmpl, buildData.Terrafile); err != nil {
+		return nil, err
+	}
 
 	var contents bytes.Buffer
 	if execErr := tmpl.Execute(&contents, buildData); execErr != nil {
@@ -87,5 +179,32 @@ func ExecTemplate(buildData *BuildData, name string, text string) (*bytes.Buffer
 func commonTemplate(name string) *template.Template {
 	return template.New(name).
 		Option("missingkey=error").
-		Funcs(sprig.TxtFuncMap())
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(templateFuncs())
+}
+
+// resolveTemplates evaluates the for_each of the templates
+func (t *Terrafile) resolveTemplates(r *resolver) error {
+	var diags hcl.Diagnostics
+	for index, tmpl := range t.Templates {
+		if tmpl.ForEach == nil || !tmpl.IsEnabled() {
+			continue
+		}
+		each, eachDiags := forEachValues(tmpl.ForEach.Expr, r.evalCtx(filepath.Dir(tmpl.ForEach.Range.Filename)))
+		diags = append(diags, eachDiags...)
+		if eachDiags.HasErrors() {
+			continue
+		}
+		goEach, convErr := fromCtyValues(each)
+		if convErr != nil {
+			return fmt.Errorf("converting for_each of template %s into Go values: %w", tmpl.Name, convErr)
+		}
+		resolved := *tmpl
+		resolved.Each = goEach
+		t.Templates[index] = &resolved
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
 }
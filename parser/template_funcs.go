@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// templateFuncs returns the Terraplate functions that are available in all Go
+// templates, in addition to the sprig functions. They turn the values from the
+// build data into correctly formatted HCL, YAML and JSON
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"toHcl":        toHcl,
+		"toHclBlock":   toHclBlock,
+		"hclQuote":     hclQuote,
+		"tfvars":       tfvars,
+		"indentHcl":    indentHcl,
+		"toYaml":       toYaml,
+		"toJsonPretty": toJsonPretty,
+	}
+}
+
+// toHcl returns a value as an HCL expression, e.g. to set an attribute to a
+// map from the values
+func toHcl(v interface{}) (string, error) {
+	val, err := toCtyValue(v)
+	if err != nil {
+		return "", fmt.Errorf("toHcl: %w", err)
+	}
+	return strings.TrimSpace(string(hclwrite.Format(hclwrite.TokensForValue(val).Bytes()))), nil
+}
+
+// toHclBlock returns a block with the given type, optional labels and the
+// keys of a map or object value as attributes, e.g.
+// {{ toHclBlock "provider" "aws" .Values.aws }}
+func toHclBlock(blockType string, args ...interface{}) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("toHclBlock: missing value for block %s", blockType)
+	}
+	var labels = make([]string, 0, len(args)-1)
+	for _, label := range args[:len(args)-1] {
+		labelStr, ok := label.(string)
+		if !ok {
+			return "", fmt.Errorf("toHclBlock: block %s: label must be a string, got %T", blockType, label)
+		}
+		labels = append(labels, labelStr)
+	}
+	file := hclwrite.NewEmptyFile()
+	block := file.Body().AppendNewBlock(blockType, labels)
+	if err := setAttributes(block.Body(), args[len(args)-1]); err != nil {
+		return "", fmt.Errorf("toHclBlock: block %s: %w", blockType, err)
+	}
+	return strings.TrimSpace(string(hclwrite.Format(file.Bytes()))), nil
+}
+
+// hclQuote returns a string as a quoted HCL string, escaping any quotes and
+// template sequences
+func hclQuote(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
+
+// tfvars returns the keys of a map or object value as attributes, such as for
+// a .tfvars file
+func tfvars(v interface{}) (string, error) {
+	file := hclwrite.NewEmptyFile()
+	if err := setAttributes(file.Body(), v); err != nil {
+		return "", fmt.Errorf("tfvars: %w", err)
+	}
+	return string(hclwrite.Format(file.Bytes())), nil
+}
+
+// indentHcl indents all lines but the first by the given number of spaces, so
+// that multi-line HCL can be embedded at the current position, e.g.
+// tags = {{ toHcl .Values.tags | indentHcl 2 }}
+func indentHcl(spaces int, s string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+strings.Repeat(" ", spaces))
+}
+
+// toYaml returns a value as YAML
+func toYaml(v interface{}) (string, error) {
+	val, err := toCtyValue(v)
+	if err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	out, marshalErr := ctyyaml.Marshal(val)
+	if marshalErr != nil {
+		return "", fmt.Errorf("toYaml: %w", marshalErr)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// toJsonPretty returns a value as indented JSON
+func toJsonPretty(v interface{}) (string, error) {
+	if val, ok := v.(cty.Value); ok {
+		simple := ctyjson.SimpleJSONValue{Value: val}
+		b, err := simple.MarshalJSON()
+		if err != nil {
+			return "", fmt.Errorf("toJsonPretty: %w", err)
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return "", fmt.Errorf("toJsonPretty: %w", err)
+		}
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("toJsonPretty: %w", err)
+	}
+	return string(out), nil
+}
+
+// setAttributes sets an attribute in the body for each key of a map or object
+// value, sorted by key
+func setAttributes(body *hclwrite.Body, v interface{}) error {
+	val, err := toCtyValue(v)
+	if err != nil {
+		return err
+	}
+	if val.IsNull() {
+		return nil
+	}
+	if !val.Type().IsObjectType() && !val.Type().IsMapType() {
+		return fmt.Errorf("value must be a map or object, got %s", val.Type().FriendlyName())
+	}
+	values := val.AsValueMap()
+	for _, name := range sortedValueKeys(values) {
+		if !hclsyntax.ValidIdentifier(name) {
+			return fmt.Errorf("key \"%s\" is not a valid attribute name", name)
+		}
+		body.SetAttributeValue(name, values[name])
+	}
+	return nil
+}
+
+// toCtyValue converts a Go value from the build data into a cty value, using
+// JSON as the build data is converted from cty values using JSON
+func toCtyValue(v interface{}) (cty.Value, error) {
+	if val, ok := v.(cty.Value); ok {
+		return val, nil
+	}
+	b, marshalErr := json.Marshal(v)
+	if marshalErr != nil {
+		return cty.NilVal, fmt.Errorf("converting %T: %w", v, marshalErr)
+	}
+	ty, typeErr := ctyjson.ImpliedType(b)
+	if typeErr != nil {
+		return cty.NilVal, fmt.Errorf("converting %T: %w", v, typeErr)
+	}
+	val, unmarshalErr := ctyjson.Unmarshal(b, ty)
+	if unmarshalErr != nil {
+		return cty.NilVal, fmt.Errorf("converting %T: %w", v, unmarshalErr)
+	}
+	return val, nil
+}
@@ -67,5 +67,16 @@ func (c *TerraConfig) MergeTerrafiles() error {
 			return fmt.Errorf("traversing terrafiles from root %s: %w", rootTf.Path, travErr)
 		}
 	}
-	return nil
+
+	// Now that the Terrafiles have inherited from their ancestors, evaluate the
+	// expressions in the root modules
+	for _, tf := range c.RootModules() {
+		if err := tf.resolve(); err != nil {
+			return fmt.Errorf("evaluating terrafile %s: %w", tf.Path, err)
+		}
+	}
+	if err := c.resolveDependsOn(); err != nil {
+		return err
+	}
+	return c.checkBackends()
 }
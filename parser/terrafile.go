@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sort"
 
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/imdario/mergo"
 	"github.com/zclconf/go-cty/cty"
 	ctyjson "github.com/zclconf/go-cty/cty/json"
@@ -14,7 +18,7 @@ import (
 // DefaultTerrafile sets default values for a Terrafile that are used when
 // parsing a new Terrafile
 var DefaultTerrafile = Terrafile{
-	// BuildBlock: &BuildBlock{},
+	BuildBlock: &BuildBlock{},
 	ExecBlock: &ExecBlock{
 		PlanBlock: &ExecPlanBlock{
 			Input:   false,
@@ -34,19 +38,47 @@ type Terrafile struct {
 	// Path
 	Path string
 	Dir  string
+	// Files contains the paths of all the Terraplate files in the directory
+	// that were combined into this Terrafile
+	Files []string
 	// IsRoot tells whether this terrafile is for a root module
 	IsRoot bool
+	// RootModule explicitly declares whether this terrafile is a root module.
+	// If not set, a terrafile is a root module if it has no child terrafiles
+	RootModule *bool `hcl:"root_module,optional"`
 	// Templates defines the list of templates that this Terrafile defines
 	Templates []*TerraTemplate `hcl:"template,block"`
+	// Partials defines named Go templates that can be used from any template
+	Partials []*TerraPartial `hcl:"partial,block"`
 
 	LocalsBlock    *TerraLocals    `hcl:"locals,block"`
 	VariablesBlock *TerraVariables `hcl:"variables,block"`
 	ValuesBlock    *TerraValues    `hcl:"values,block"`
+	// VariableBlocks defines the variable{} blocks, which are an alternative
+	// to the variables{} block for declaring variables with a type,
+	// description, validation, etc.
+	VariableBlocks []*TerraVariable `hcl:"variable,block"`
+	// Merges defines how locals, variables and values are merged with those
+	// inherited from ancestors
+	Merges []*TerraMerge `hcl:"merge,block"`
+	// ExcludeBlock removes templates, locals, variables and values inherited
+	// from ancestors
+	ExcludeBlock *TerraExclude `hcl:"exclude,block"`
 
 	TerraformBlock *TerraformBlock `hcl:"terraform,block"`
-
-	// BuildBlock *BuildBlock `hcl:"build,block"`
-	ExecBlock *ExecBlock `hcl:"exec,block"`
+	// BackendBlock defines the Terraform backend, which is built into the
+	// terraform{} block
+	BackendBlock *TerraBackend `hcl:"backend,block"`
+	// Providers defines the provider{} blocks, which are built into Terraform
+	// provider blocks
+	Providers []*TerraProvider `hcl:"provider,block"`
+	// Dependencies defines the dependency{} blocks, which make the outputs of
+	// other root modules available to the templates
+	Dependencies []*TerraDependency `hcl:"dependency,block"`
+
+	// BuildBlock configures how the files are built, such as their header
+	BuildBlock *BuildBlock `hcl:"build,block"`
+	ExecBlock  *ExecBlock  `hcl:"exec,block"`
 
 	// Ancestor defines any parent/ancestor Terrafiles that this Terrafile
 	// should inherit from
@@ -54,43 +86,69 @@ type Terrafile struct {
 
 	// Children contains any child Terrafiles to this Terrafile
 	Children []*Terrafile
-}
-
-// TerraformBlock defines the terraform{} block within a Terrafile
-type TerraformBlock struct {
-	RequiredVersion        string                  `hcl:"required_version,optional"`
-	RequiredProvidersBlock *TerraRequiredProviders `hcl:"required_providers,block"`
-}
-
-// RequiredProviders returns the map of terraform required_providers, or nil
-func (tb *TerraformBlock) RequiredProviders() map[string]RequiredProvider {
-	if tb.RequiredProvidersBlock == nil {
-		return nil
-	}
-	return tb.RequiredProvidersBlock.RequiredProviders
-}
-
-// TerraRequiredProviders defines the map of required_providers
-type TerraRequiredProviders struct {
-	RequiredProviders map[string]RequiredProvider `hcl:",remain"`
-}
 
-// RequiredProvider defines the body of required_providers
-type RequiredProvider struct {
-	Source  string `hcl:"source,attr" cty:"source"`
-	Version string `hcl:"version,attr" cty:"version"`
+	// origins contains where each setting was defined, including the
+	// definitions inherited from ancestors
+	origins map[string][]Origin
+	// rootModuleRange is the range of the root_module attribute, if set
+	rootModuleRange hcl.Range
+	// dependsOn contains the root modules declared by depends_on in the exec{}
+	// block once the Terrafiles have been resolved
+	dependsOn []*Terrafile
 }
 
+// TerraLocals defines the locals{} block within a Terrafile, which is built
+// into the locals{} block of the terraplate.tf file
 type TerraLocals struct {
-	Locals map[string]cty.Value `hcl:",remain"`
+	Attributes hcl.Attributes `hcl:",remain"`
+	// Overridden contains the attributes inherited from ancestors that have
+	// been overridden, ordered from the nearest ancestor
+	Overridden map[string][]*hcl.Attribute
+	// Locals contains the evaluated locals, including the inherited ones
+	Locals map[string]cty.Value
 }
 
+// TerraValues defines the values{} block within a Terrafile, which are only
+// available to Terraplate and are not built into Terraform files
 type TerraValues struct {
-	Values map[string]cty.Value `hcl:",remain"`
+	Attributes hcl.Attributes `hcl:",remain"`
+	// Overridden contains the attributes inherited from ancestors that have
+	// been overridden, ordered from the nearest ancestor
+	Overridden map[string][]*hcl.Attribute
+	Values     map[string]cty.Value
 }
 
+// TerraVariables defines the variables{} block within a Terrafile. Each
+// variable is built into a variable block with its value as the default
 type TerraVariables struct {
-	Variables map[string]cty.Value `hcl:",remain"`
+	Attributes hcl.Attributes `hcl:",remain"`
+	// Overridden contains the attributes inherited from ancestors that have
+	// been overridden, ordered from the nearest ancestor
+	Overridden map[string][]*hcl.Attribute
+	Variables  map[string]cty.Value
+}
+
+// TerraVariable defines the variable{} block within a Terrafile, which is
+// built into a Terraform variable declaration.
+// The default is evaluated like the attributes in the variables{} block, and the
+// type and validation are written as they are, without being evaluated
+type TerraVariable struct {
+	Name        string                     `hcl:",label"`
+	Type        *hcl.Attribute             `hcl:"type,optional"`
+	Default     *hcl.Attribute             `hcl:"default,optional"`
+	Description string                     `hcl:"description,optional"`
+	Sensitive   *bool                      `hcl:"sensitive,optional"`
+	Nullable    *bool                      `hcl:"nullable,optional"`
+	Validations []*TerraVariableValidation `hcl:"validation,block"`
+	// DeclRange is the range of the variable block in the Terrafile
+	DeclRange hcl.Range
+}
+
+// TerraVariableValidation defines the validation{} block within a variable{}
+// block
+type TerraVariableValidation struct {
+	Condition    *hcl.Attribute `hcl:"condition,attr"`
+	ErrorMessage *hcl.Attribute `hcl:"error_message,attr"`
 }
 
 // parseTerrafile parses the terrafile given by the input string and returns
@@ -99,25 +157,253 @@ func parseTerrafile(file string) (*Terrafile, error) {
 
 	terrafileDir := filepath.Dir(file)
 
+	hclFile, diags := hclparse.NewParser().ParseHCLFile(file)
+	if diags.HasErrors() {
+		return nil, diags
+	}
 	var terrafile Terrafile
-	if err := hclsimple.DecodeFile(file, evalCtx(terrafileDir), &terrafile); err != nil {
-		return nil, fmt.Errorf("decoding terraplate file %s: %w", file, err)
+	if diags := gohcl.DecodeBody(hclFile.Body, evalCtx(terrafileDir), &terrafile); diags.HasErrors() {
+		return nil, diags
+	}
+	// gohcl does not provide the ranges of blocks, so get the blocks again to
+	// set their ranges for diagnostics. The blocks are in the same order
+	content, _, _ := hclFile.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "root_module"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "template", LabelNames: []string{"name"}},
+			{Type: "backend", LabelNames: []string{"type"}},
+			{Type: "provider", LabelNames: []string{"name"}},
+			{Type: "dependency", LabelNames: []string{"name"}},
+			{Type: "partial", LabelNames: []string{"name"}},
+			{Type: "variable", LabelNames: []string{"name"}},
+			{Type: "merge", LabelNames: []string{"block"}},
+			{Type: "build"},
+			{Type: "exec"},
+		},
+	})
+	if attr, ok := content.Attributes["root_module"]; ok {
+		terrafile.rootModuleRange = attr.NameRange
+	}
+	for index, block := range content.Blocks.OfType("template") {
+		if index >= len(terrafile.Templates) {
+			continue
+		}
+		tmpl := terrafile.Templates[index]
+		tmpl.DeclRange = block.DefRange
+		// Disabled templates do not need any contents
+		if body, ok := block.Body.(*hclsyntax.Body); ok && tmpl.IsEnabled() {
+			if _, ok := body.Attributes["contents"]; !ok {
+				return nil, hcl.Diagnostics{
+					{
+						Severity: hcl.DiagError,
+						Summary:  "Missing required argument",
+						Detail:   fmt.Sprintf("The argument \"contents\" is required for template \"%s\", unless it is disabled with enabled = false.", tmpl.Name),
+						Subject:  tmpl.DeclRange.Ptr(),
+					},
+				}
+			}
+		}
+	}
+	for index, block := range content.Blocks.OfType("provider") {
+		if index < len(terrafile.Providers) {
+			terrafile.Providers[index].DeclRange = block.DefRange
+		}
+	}
+	for index, block := range content.Blocks.OfType("partial") {
+		if index < len(terrafile.Partials) {
+			terrafile.Partials[index].DeclRange = block.DefRange
+		}
+	}
+	for index, block := range content.Blocks.OfType("dependency") {
+		if index < len(terrafile.Dependencies) {
+			terrafile.Dependencies[index].DeclRange = block.DefRange
+		}
+	}
+	for index, block := range content.Blocks.OfType("variable") {
+		if index < len(terrafile.VariableBlocks) {
+			terrafile.VariableBlocks[index].DeclRange = block.DefRange
+		}
+	}
+	for index, block := range content.Blocks.OfType("merge") {
+		if index < len(terrafile.Merges) {
+			terrafile.Merges[index].DeclRange = block.DefRange
+		}
+	}
+	for _, block := range content.Blocks.OfType("build") {
+		if terrafile.BuildBlock != nil {
+			terrafile.BuildBlock.DeclRange = block.DefRange
+		}
+	}
+	for _, block := range content.Blocks.OfType("exec") {
+		if terrafile.ExecBlock != nil {
+			terrafile.ExecBlock.DeclRange = block.DefRange
+		}
+	}
+	for index, dep := range terrafile.Dependencies {
+		if err := dep.validate(); err != nil {
+			return nil, err
+		}
+		for _, other := range terrafile.Dependencies[:index] {
+			if other.Name == dep.Name {
+				return nil, hcl.Diagnostics{
+					{
+						Severity: hcl.DiagError,
+						Summary:  "Duplicate dependency",
+						Detail:   fmt.Sprintf("The dependency \"%s\" is defined more than once in %s.", dep.Name, file),
+						Subject:  dep.DeclRange.Ptr(),
+					},
+				}
+			}
+		}
+	}
+	if terrafile.TerraformBlock != nil && terrafile.TerraformBlock.RequiredProvidersBlock != nil {
+		if diags := terrafile.TerraformBlock.RequiredProvidersBlock.decode(); diags.HasErrors() {
+			return nil, diags
+		}
+	}
+	if terrafile.ExecBlock != nil && terrafile.ExecBlock.EnvAttr != nil {
+		terrafile.ExecBlock.EnvAttrs = []*hcl.Attribute{terrafile.ExecBlock.EnvAttr}
+	}
+	if terrafile.BackendBlock != nil {
+		for _, block := range content.Blocks.OfType("backend") {
+			terrafile.BackendBlock.DeclRange = block.DefRange
+		}
+		if err := terrafile.BackendBlock.validate(); err != nil {
+			return nil, err
+		}
 	}
 	terrafile.Path = file
 	terrafile.Dir = terrafileDir
-	// Set the default to be a root module. If an ancestor is added it is set to false
-	terrafile.IsRoot = true
+	terrafile.Files = []string{file}
+	if body, ok := hclFile.Body.(*hclsyntax.Body); ok {
+		terrafile.origins = bodyOrigins(file, body)
+	}
+	// Set the default to be a root module, unless explicitly declared. If a
+	// child is added it is set to false, unless explicitly declared
+	terrafile.IsRoot = terrafile.isDeclaredRoot()
+
+	for _, merge := range terrafile.Merges {
+		if err := merge.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	for index, variable := range terrafile.VariableBlocks {
+		for _, other := range terrafile.VariableBlocks[:index] {
+			if other.Name == variable.Name {
+				return nil, hcl.Diagnostics{
+					{
+						Severity: hcl.DiagError,
+						Summary:  "Duplicate variable declaration",
+						Detail:   fmt.Sprintf("A variable named \"%s\" was already declared at %s. Variable names must be unique within a Terrafile.", variable.Name, other.DeclRange),
+						Subject:  variable.DeclRange.Ptr(),
+					},
+				}
+			}
+		}
+	}
+	// Add the defaults from variable{} blocks to the variables, so that they
+	// are evaluated and inherited in the same way
+	for _, variable := range terrafile.VariableBlocks {
+		if attr, ok := terrafile.variablesAttributes()[variable.Name]; ok {
+			return nil, hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate variable",
+					Detail:   fmt.Sprintf("Variable \"%s\" is defined in both a variables block and a variable block.", variable.Name),
+					Subject:  attr.NameRange.Ptr(),
+				},
+			}
+		}
+		if variable.Default == nil {
+			continue
+		}
+		if terrafile.VariablesBlock == nil {
+			terrafile.VariablesBlock = &TerraVariables{
+				Attributes: make(hcl.Attributes),
+			}
+		}
+		terrafile.VariablesBlock.Attributes[variable.Name] = &hcl.Attribute{
+			Name:      variable.Name,
+			Expr:      variable.Default.Expr,
+			Range:     variable.Default.Range,
+			NameRange: variable.Default.NameRange,
+		}
+	}
 
 	for _, tmpl := range terrafile.Templates {
 		// Set the defaults for defined templates
 		if tmpl.Target == "" {
 			tmpl.Target = tmpl.Name + ".tp.tf"
+			if tmpl.ForEach != nil {
+				tmpl.Target = tmpl.Name + "_{{ .Each.Key }}.tp.tf"
+			}
 		}
 	}
 
 	return &terrafile, nil
 }
 
+// parseTerrafiles parses the terrafiles given by the list of files, which
+// should all be in the same directory, and combines them into a single Terrafile.
+// If a "terraplate.hcl" file exists it is used as the path for the Terrafile,
+// otherwise the first file is used.
+// If no files are given, nil is returned
+func parseTerrafiles(files []string) (*Terrafile, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var terrafiles = make([]*Terrafile, 0, len(files))
+	for _, file := range files {
+		terrafile, parseErr := parseTerrafile(file)
+		if parseErr != nil {
+			return nil, fmt.Errorf("parsing terraplate file %s: %w", file, parseErr)
+		}
+		// Make sure the terraplate.hcl file comes first so that it is used as
+		// the path for the combined Terrafile
+		if filepath.Base(file) == "terraplate.hcl" {
+			terrafiles = append([]*Terrafile{terrafile}, terrafiles...)
+			continue
+		}
+		terrafiles = append(terrafiles, terrafile)
+	}
+
+	// Check for conflicts between each pair of Terrafiles before combining them
+	for i, tf := range terrafiles {
+		for _, other := range terrafiles[i+1:] {
+			if err := tf.conflicts(other); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	terrafile := terrafiles[0]
+	for _, other := range terrafiles[1:] {
+		terrafile.combineTerrafile(other)
+	}
+	terrafile.IsRoot = terrafile.isDeclaredRoot()
+	return terrafile, nil
+}
+
+// addChild creates the parent/child relationship between this terrafile and
+// the child. Unless explicitly declared, a terrafile with a child is not a
+// root module
+func (t *Terrafile) addChild(child *Terrafile) {
+	if t.RootModule == nil {
+		t.IsRoot = false
+	}
+	t.Children = append(t.Children, child)
+	child.Ancestor = t
+}
+
+// isDeclaredRoot returns false if the terrafile has been explicitly declared as
+// not being a root module, otherwise true
+func (t *Terrafile) isDeclaredRoot() bool {
+	return t.RootModule == nil || *t.RootModule
+}
+
 // traverseChildren goes down the tree of terrafiles calling the visit function
 // on each terrafile in the path
 func (t *Terrafile) traverseChildren(visit func(parent *Terrafile, tf *Terrafile) error) error {
@@ -175,21 +461,6 @@ func (t *Terrafile) rootAncestor() *Terrafile {
 	return tf
 }
 
-// rootModules returns the root modules that are children of this terrafile
-func (t *Terrafile) rootModules() []*Terrafile {
-	var terrafiles = make([]*Terrafile, 0)
-	if t.IsRoot {
-		terrafiles = append(terrafiles, t)
-	}
-	t.traverseChildren(func(parent *Terrafile, child *Terrafile) error {
-		if child.IsRoot {
-			terrafiles = append(terrafiles, child)
-		}
-		return nil
-	})
-	return terrafiles
-}
-
 func (t *Terrafile) BuildData() (*BuildData, error) {
 	buildLocals, err := t.LocalsAsGo()
 	if err != nil {
@@ -203,10 +474,15 @@ func (t *Terrafile) BuildData() (*BuildData, error) {
 	if valuesErr != nil {
 		return nil, fmt.Errorf("getting build values for terrafile \"%s\": %w", t.Path, valuesErr)
 	}
+	buildDeps, depsErr := t.DependenciesAsGo()
+	if depsErr != nil {
+		return nil, fmt.Errorf("getting build dependencies for terrafile \"%s\": %w", t.Path, depsErr)
+	}
 	return &BuildData{
 		Locals:          buildLocals,
 		Variables:       buildVars,
 		Values:          buildValues,
+		Dependencies:    buildDeps,
 		Terrafile:       t,
 		RelativePath:    t.RelativePath(),
 		RelativeDir:     t.RelativeDir(),
@@ -283,13 +559,24 @@ func (t *Terrafile) RelativePath() string {
 // We cannot simply merge all fields as templates (for example) are treated a bit
 // special
 func (t *Terrafile) mergeTerrafile(parent *Terrafile) error {
+	// Anything excluded by the terrafile is not inherited
+	parent = t.withoutExcluded(parent)
 
 	t.mergeLocals(parent)
 	t.mergeVariables(parent)
+	t.mergeVariableBlocks(parent)
 	t.mergeValues(parent)
+	t.mergeMerges(parent)
 	t.mergeTemplates(parent)
+	t.mergePartials(parent)
 	t.mergeTerraformBlock(parent)
+	t.mergeBackendBlock(parent)
+	t.mergeProviders(parent)
+	t.mergeOrigins(parent)
 
+	if mergeErr := t.mergeBuildBlock(parent); mergeErr != nil {
+		return mergeErr
+	}
 	if mergeErr := t.mergeExecBlock(parent); mergeErr != nil {
 		return mergeErr
 	}
@@ -297,62 +584,289 @@ func (t *Terrafile) mergeTerrafile(parent *Terrafile) error {
 	return nil
 }
 
+// conflicts returns diagnostics for every setting that is defined in both
+// Terrafiles, as Terrafiles in the same directory cannot override each other
+func (t *Terrafile) conflicts(other *Terrafile) error {
+	var diags hcl.Diagnostics
+	conflict := func(kind string, name string, subject *hcl.Range) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Duplicate %s", kind),
+			Detail:   fmt.Sprintf("The %s \"%s\" is defined in both %s and %s.", kind, name, t.Path, other.Path),
+			Subject:  subject,
+		})
+	}
+	// Iterate over the attributes in order, so that the diagnostics are the
+	// same each time
+	for _, name := range sortedAttributeNames(other.localsAttributes()) {
+		if _, ok := t.localsAttributes()[name]; ok {
+			conflict("local", name, other.localsAttributes()[name].NameRange.Ptr())
+		}
+	}
+	for _, name := range sortedAttributeNames(other.valuesAttributes()) {
+		if _, ok := t.valuesAttributes()[name]; ok {
+			conflict("value", name, other.valuesAttributes()[name].NameRange.Ptr())
+		}
+	}
+	// Variables can come from both the variables attributes and the variable
+	// blocks, and the defaults of the blocks are also added to the attributes,
+	// so report each variable once
+	tVariables, otherVariables := t.variableRanges(), other.variableRanges()
+	otherNames := make([]string, 0, len(otherVariables))
+	for name := range otherVariables {
+		otherNames = append(otherNames, name)
+	}
+	sort.Strings(otherNames)
+	for _, name := range otherNames {
+		if _, ok := tVariables[name]; ok {
+			conflict("variable", name, otherVariables[name].Ptr())
+		}
+	}
+	for _, otherTmpl := range other.Templates {
+		for _, tmpl := range t.Templates {
+			if tmpl.Name == otherTmpl.Name {
+				conflict("template", tmpl.Name, otherTmpl.DeclRange.Ptr())
+				break
+			}
+		}
+	}
+	for _, otherPartial := range other.Partials {
+		if t.partial(otherPartial.Name) != nil {
+			conflict("partial", otherPartial.Name, otherPartial.DeclRange.Ptr())
+		}
+	}
+	for _, otherProvider := range other.Providers {
+		if t.provider(otherProvider.key()) != nil {
+			conflict("provider", otherProvider.key(), otherProvider.DeclRange.Ptr())
+		}
+	}
+	for _, otherDep := range other.Dependencies {
+		if t.dependency(otherDep.Name) != nil {
+			conflict("dependency", otherDep.Name, otherDep.DeclRange.Ptr())
+		}
+	}
+	for _, otherMerge := range other.Merges {
+		if t.merge(otherMerge.Block) != nil {
+			conflict("merge", otherMerge.Block, otherMerge.DeclRange.Ptr())
+		}
+	}
+	if t.TerraformBlock != nil && other.TerraformBlock != nil {
+		if t.TerraformBlock.RequiredVersion != "" && other.TerraformBlock.RequiredVersion != "" {
+			var subject *hcl.Range
+			if origins := other.Origins("terraform.required_version"); len(origins) > 0 {
+				subject = origins[0].Range.Ptr()
+			}
+			conflict("setting", "required_version", subject)
+		}
+		if other.TerraformBlock.RequiredProvidersBlock != nil {
+			otherProviders := other.TerraformBlock.RequiredProvidersBlock.Attributes
+			for _, name := range sortedAttributeNames(otherProviders) {
+				if _, ok := t.TerraformBlock.RequiredProviders()[name]; ok {
+					conflict("required provider", name, otherProviders[name].NameRange.Ptr())
+				}
+			}
+		}
+		if t.TerraformBlock.Experiments != nil && other.TerraformBlock.Experiments != nil {
+			conflict("setting", "experiments", other.TerraformBlock.Experiments.NameRange.Ptr())
+		}
+		if t.TerraformBlock.CloudBlock != nil && other.TerraformBlock.CloudBlock != nil {
+			conflict("block", "cloud", syntaxBody(other.TerraformBlock.CloudBlock.Body).SrcRange.Ptr())
+		}
+		for _, otherMeta := range other.TerraformBlock.ProviderMetas {
+			if t.TerraformBlock.providerMeta(otherMeta.Name) != nil {
+				conflict("provider_meta", otherMeta.Name, syntaxBody(otherMeta.Body).SrcRange.Ptr())
+			}
+		}
+	}
+	if t.BackendBlock != nil && other.BackendBlock != nil {
+		conflict("backend", other.BackendBlock.Type, other.BackendBlock.DeclRange.Ptr())
+	}
+	if t.BuildBlock != nil && other.BuildBlock != nil {
+		conflict("block", "build", other.BuildBlock.DeclRange.Ptr())
+	}
+	if t.ExecBlock != nil && other.ExecBlock != nil {
+		conflict("block", "exec", other.ExecBlock.DeclRange.Ptr())
+	}
+	if t.RootModule != nil && other.RootModule != nil {
+		conflict("setting", "root_module", other.rootModuleRange.Ptr())
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
+// combineTerrafile combines a Terrafile from the same directory into this one.
+// Unlike merging with an ancestor nothing is overridden, so conflicts should be
+// checked before combining
+func (t *Terrafile) combineTerrafile(other *Terrafile) {
+	t.Files = append(t.Files, other.Files...)
+	t.Templates = append(t.Templates, other.Templates...)
+	t.Partials = append(t.Partials, other.Partials...)
+	t.VariableBlocks = append(t.VariableBlocks, other.VariableBlocks...)
+	t.Merges = append(t.Merges, other.Merges...)
+	t.Providers = append(t.Providers, other.Providers...)
+	t.Dependencies = append(t.Dependencies, other.Dependencies...)
+	t.combineOrigins(other)
+
+	// The merge functions only add entries that do not exist, which is exactly
+	// what we want when there are no conflicts
+	t.mergeLocals(other)
+	t.mergeVariables(other)
+	t.mergeValues(other)
+
+	if other.TerraformBlock != nil {
+		if t.TerraformBlock == nil {
+			t.TerraformBlock = &TerraformBlock{}
+		}
+		t.mergeTerraformBlock(other)
+	}
+	if t.BackendBlock == nil {
+		t.BackendBlock = other.BackendBlock
+	}
+	if t.BuildBlock == nil {
+		t.BuildBlock = other.BuildBlock
+	}
+	if t.ExecBlock == nil {
+		t.ExecBlock = other.ExecBlock
+	}
+	if other.ExcludeBlock != nil {
+		if t.ExcludeBlock == nil {
+			t.ExcludeBlock = &TerraExclude{}
+		}
+		t.ExcludeBlock.combine(other.ExcludeBlock)
+	}
+	if t.RootModule == nil {
+		t.RootModule = other.RootModule
+	}
+}
+
 func (t *Terrafile) mergeExecBlock(parent *Terrafile) error {
 	// If terrafile's exec block is nil, we can simply inherit the ancestor's one
 	if t.ExecBlock == nil {
 		t.ExecBlock = &ExecBlock{}
 	}
+	// The env attributes are merged when they are evaluated, so keep all of them
+	envAttrs := append(append([]*hcl.Attribute{}, t.ExecBlock.EnvAttrs...), parent.ExecBlock.EnvAttrs...)
+	// Dependencies are relative to the directory that declares them, so they
+	// are not inherited
+	dependsOn := t.ExecBlock.DependsOn
 	// Merge ExecBlock
 	if err := mergo.Merge(t.ExecBlock, parent.ExecBlock); err != nil {
 		return fmt.Errorf("merging exec{} block: %w", err)
 	}
+	t.ExecBlock.EnvAttrs = envAttrs
+	t.ExecBlock.DependsOn = dependsOn
 	return nil
 }
 
 func (t *Terrafile) mergeLocals(parent *Terrafile) {
-	tfLocals := t.Locals()
-	if t.Locals() == nil {
-		tfLocals = make(map[string]cty.Value)
-	}
-	for name, value := range parent.Locals() {
-		if _, ok := tfLocals[name]; !ok {
-			tfLocals[name] = value
-		}
+	var block = &TerraLocals{}
+	if t.LocalsBlock != nil {
+		block.Attributes, block.Overridden = t.LocalsBlock.Attributes, t.LocalsBlock.Overridden
 	}
-	t.LocalsBlock = &TerraLocals{
-		Locals: tfLocals,
+	if parent.LocalsBlock != nil {
+		block.Attributes, block.Overridden = mergeAttributes(
+			block.Attributes, block.Overridden,
+			parent.LocalsBlock.Attributes, parent.LocalsBlock.Overridden,
+		)
 	}
-
+	t.LocalsBlock = block
 }
 
 func (t *Terrafile) mergeVariables(parent *Terrafile) {
-	tfVars := t.Variables()
-	if t.Variables() == nil {
-		tfVars = make(map[string]cty.Value)
-	}
-	for name, value := range parent.Variables() {
-		if _, ok := tfVars[name]; !ok {
-			tfVars[name] = value
-		}
+	var block = &TerraVariables{}
+	if t.VariablesBlock != nil {
+		block.Attributes, block.Overridden = t.VariablesBlock.Attributes, t.VariablesBlock.Overridden
 	}
-	t.VariablesBlock = &TerraVariables{
-		Variables: tfVars,
+	if parent.VariablesBlock != nil {
+		block.Attributes, block.Overridden = mergeAttributes(
+			block.Attributes, block.Overridden,
+			parent.VariablesBlock.Attributes, parent.VariablesBlock.Overridden,
+		)
 	}
+	t.VariablesBlock = block
 }
 
 func (t *Terrafile) mergeValues(parent *Terrafile) {
-	tfValues := t.Values()
-	if t.Values() == nil {
-		tfValues = make(map[string]cty.Value)
+	var block = &TerraValues{}
+	if t.ValuesBlock != nil {
+		block.Attributes, block.Overridden = t.ValuesBlock.Attributes, t.ValuesBlock.Overridden
+	}
+	if parent.ValuesBlock != nil {
+		block.Attributes, block.Overridden = mergeAttributes(
+			block.Attributes, block.Overridden,
+			parent.ValuesBlock.Attributes, parent.ValuesBlock.Overridden,
+		)
+	}
+	t.ValuesBlock = block
+}
+
+// mergeAttributes returns a new map containing the attributes, with any parent
+// attributes added that are not already defined.
+// Parent attributes that are already defined are added to the overridden
+// attributes, so that they can still be used when deep merging
+func mergeAttributes(
+	attrs hcl.Attributes, overridden map[string][]*hcl.Attribute,
+	parentAttrs hcl.Attributes, parentOverridden map[string][]*hcl.Attribute,
+) (hcl.Attributes, map[string][]*hcl.Attribute) {
+	var (
+		mergedAttrs      = make(hcl.Attributes, len(attrs)+len(parentAttrs))
+		mergedOverridden = make(map[string][]*hcl.Attribute)
+	)
+	for name, attr := range attrs {
+		mergedAttrs[name] = attr
+	}
+	for name, attrs := range overridden {
+		mergedOverridden[name] = append(mergedOverridden[name], attrs...)
+	}
+	for name, attr := range parentAttrs {
+		if _, ok := mergedAttrs[name]; !ok {
+			mergedAttrs[name] = attr
+			mergedOverridden[name] = append(mergedOverridden[name], parentOverridden[name]...)
+			continue
+		}
+		mergedOverridden[name] = append(mergedOverridden[name], attr)
+		mergedOverridden[name] = append(mergedOverridden[name], parentOverridden[name]...)
 	}
-	for name, value := range parent.Values() {
-		if _, ok := tfValues[name]; !ok {
-			tfValues[name] = value
+	return mergedAttrs, mergedOverridden
+}
+
+// mergeVariableBlocks merges the variable{} blocks from a parent to a terrafile.
+// Variable blocks are matched by name and child variable blocks override parent
+// variable blocks. The defaults are merged separately with the variables
+func (t *Terrafile) mergeVariableBlocks(parent *Terrafile) {
+	for _, parentVar := range parent.VariableBlocks {
+		if t.VariableBlock(parentVar.Name) == nil {
+			t.VariableBlocks = append(t.VariableBlocks, parentVar)
+		}
+	}
+}
+
+// VariableBlock returns the variable{} block with the given name, or nil
+func (t *Terrafile) VariableBlock(name string) *TerraVariable {
+	for _, variable := range t.VariableBlocks {
+		if variable.Name == name {
+			return variable
 		}
 	}
-	t.ValuesBlock = &TerraValues{
-		Values: tfValues,
+	return nil
+}
+
+// VariableNames returns the sorted names of all the variables, including
+// those declared in variable{} blocks without a default
+func (t *Terrafile) VariableNames() []string {
+	var names = make([]string, 0, len(t.Variables())+len(t.VariableBlocks))
+	for name := range t.Variables() {
+		names = append(names, name)
 	}
+	for _, variable := range t.VariableBlocks {
+		if _, ok := t.Variables()[variable.Name]; !ok {
+			names = append(names, variable.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // mergeTemplates merges templates from a parent to a terrafile.
@@ -378,29 +892,6 @@ func (t *Terrafile) mergeTemplates(parent *Terrafile) {
 	t.Templates = append(t.Templates, mergeTemplates...)
 }
 
-func (t *Terrafile) mergeTerraformBlock(parent *Terrafile) {
-	if t.TerraformBlock == nil {
-		t.TerraformBlock = &TerraformBlock{}
-	}
-	block := t.TerraformBlock
-
-	if block.RequiredVersion == "" {
-		block.RequiredVersion = parent.TerraformBlock.RequiredVersion
-	}
-	var requiredProviders = block.RequiredProviders()
-	if requiredProviders == nil {
-		requiredProviders = make(map[string]RequiredProvider)
-	}
-	for name, value := range parent.TerraformBlock.RequiredProviders() {
-		if _, ok := requiredProviders[name]; !ok {
-			requiredProviders[name] = value
-		}
-	}
-	block.RequiredProvidersBlock = &TerraRequiredProviders{
-		RequiredProviders: requiredProviders,
-	}
-}
-
 func (t *Terrafile) Locals() map[string]cty.Value {
 	if t.LocalsBlock == nil {
 		return nil
@@ -422,6 +913,40 @@ func (t *Terrafile) Values() map[string]cty.Value {
 	return t.ValuesBlock.Values
 }
 
+func (t *Terrafile) localsAttributes() hcl.Attributes {
+	if t.LocalsBlock == nil {
+		return nil
+	}
+	return t.LocalsBlock.Attributes
+}
+
+func (t *Terrafile) variablesAttributes() hcl.Attributes {
+	if t.VariablesBlock == nil {
+		return nil
+	}
+	return t.VariablesBlock.Attributes
+}
+
+// variableRanges returns the ranges of the variables declared in the
+// Terrafile, by name, preferring the variable block over the attribute
+func (t *Terrafile) variableRanges() map[string]hcl.Range {
+	ranges := make(map[string]hcl.Range)
+	for name, attr := range t.variablesAttributes() {
+		ranges[name] = attr.NameRange
+	}
+	for _, variable := range t.VariableBlocks {
+		ranges[variable.Name] = variable.DeclRange
+	}
+	return ranges
+}
+
+func (t *Terrafile) valuesAttributes() hcl.Attributes {
+	if t.ValuesBlock == nil {
+		return nil
+	}
+	return t.ValuesBlock.Attributes
+}
+
 func (t *Terrafile) LocalsAsGo() (map[string]interface{}, error) {
 	locals, err := fromCtyValues(t.Locals())
 	if err != nil {
@@ -0,0 +1,290 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// TerraformBlock defines the terraform{} block within a Terrafile
+type TerraformBlock struct {
+	RequiredVersion        string                  `hcl:"required_version,optional"`
+	RequiredProvidersBlock *TerraRequiredProviders `hcl:"required_providers,block"`
+	// Experiments contains the experiments to enable, which are written as
+	// they are without being evaluated
+	Experiments   *hcl.Attribute       `hcl:"experiments,optional"`
+	CloudBlock    *TerraformCloud      `hcl:"cloud,block"`
+	ProviderMetas []*TerraProviderMeta `hcl:"provider_meta,block"`
+}
+
+// RequiredProviders returns the map of terraform required_providers, or nil
+func (tb *TerraformBlock) RequiredProviders() map[string]RequiredProvider {
+	if tb.RequiredProvidersBlock == nil {
+		return nil
+	}
+	return tb.RequiredProvidersBlock.RequiredProviders
+}
+
+// providerMeta returns the provider_meta{} block with the given name, or nil
+func (tb *TerraformBlock) providerMeta(name string) *TerraProviderMeta {
+	for _, meta := range tb.ProviderMetas {
+		if meta.Name == name {
+			return meta
+		}
+	}
+	return nil
+}
+
+// TerraRequiredProviders defines the map of required_providers.
+// The attributes are decoded into RequiredProviders when parsing, as the
+// configuration_aliases contain references that cannot be evaluated
+type TerraRequiredProviders struct {
+	Attributes        hcl.Attributes `hcl:",remain"`
+	RequiredProviders map[string]RequiredProvider
+}
+
+// RequiredProvider defines the body of required_providers
+type RequiredProvider struct {
+	Source  string
+	Version string
+	// ConfigurationAliases contains the aliases of the provider that a module
+	// expects to be passed, e.g. aws.west
+	ConfigurationAliases []string
+}
+
+// decode decodes the attributes of the required_providers{} block.
+// Each attribute is either an object with the source, version and
+// configuration_aliases, or a string with the version (legacy syntax)
+func (rp *TerraRequiredProviders) decode() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	rp.RequiredProviders = make(map[string]RequiredProvider, len(rp.Attributes))
+	for name, attr := range rp.Attributes {
+		provider, provDiags := decodeRequiredProvider(attr)
+		diags = append(diags, provDiags...)
+		rp.RequiredProviders[name] = provider
+	}
+	return diags
+}
+
+func decodeRequiredProvider(attr *hcl.Attribute) (RequiredProvider, hcl.Diagnostics) {
+	var provider RequiredProvider
+	// Support the legacy syntax, where only the version is given
+	if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String {
+		if !value.IsNull() {
+			provider.Version = value.AsString()
+		}
+		return provider, nil
+	}
+	pairs, diags := hcl.ExprMap(attr.Expr)
+	if diags.HasErrors() {
+		return provider, diags
+	}
+	invalidDiags := func(detail string, subject hcl.Range) hcl.Diagnostics {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid required provider",
+			Detail:   detail,
+			Subject:  subject.Ptr(),
+		})
+	}
+	for _, pair := range pairs {
+		key, keyDiags := pair.Key.Value(nil)
+		diags = append(diags, keyDiags...)
+		if keyDiags.HasErrors() {
+			continue
+		}
+		if key.Type() != cty.String || key.IsNull() {
+			diags = invalidDiags("The keys of a required provider must be strings.", pair.Key.Range())
+			continue
+		}
+		switch key.AsString() {
+		case "source", "version":
+			value, valueDiags := pair.Value.Value(nil)
+			diags = append(diags, valueDiags...)
+			if valueDiags.HasErrors() {
+				continue
+			}
+			value, convErr := convert.Convert(value, cty.String)
+			if convErr != nil || value.IsNull() {
+				diags = invalidDiags(fmt.Sprintf("The %s of a required provider must be a string.", key.AsString()), pair.Value.Range())
+				continue
+			}
+			if key.AsString() == "source" {
+				provider.Source = value.AsString()
+			} else {
+				provider.Version = value.AsString()
+			}
+		case "configuration_aliases":
+			exprs, listDiags := hcl.ExprList(pair.Value)
+			diags = append(diags, listDiags...)
+			for _, expr := range exprs {
+				traversal, travDiags := hcl.AbsTraversalForExpr(expr)
+				diags = append(diags, travDiags...)
+				if travDiags.HasErrors() {
+					continue
+				}
+				provider.ConfigurationAliases = append(provider.ConfigurationAliases, traversalString(traversal))
+			}
+		default:
+			diags = invalidDiags(fmt.Sprintf("Unsupported argument \"%s\": a required provider can have source, version and configuration_aliases.", key.AsString()), pair.Key.Range())
+		}
+	}
+	return provider, diags
+}
+
+// Tokens returns the tokens for writing the required provider as an object
+func (p RequiredProvider) Tokens() hclwrite.Tokens {
+	var tokens = hclwrite.Tokens{
+		{Type: hclsyntax.TokenOBrace, Bytes: []byte("{")},
+		{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+	}
+	appendAttr := func(name string, value hclwrite.Tokens) {
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte(name)})
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenEqual, Bytes: []byte("=")})
+		tokens = append(tokens, value...)
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
+	}
+	if p.Source != "" {
+		appendAttr("source", hclwrite.TokensForValue(cty.StringVal(p.Source)))
+	}
+	if p.Version != "" {
+		appendAttr("version", hclwrite.TokensForValue(cty.StringVal(p.Version)))
+	}
+	if len(p.ConfigurationAliases) > 0 {
+		var aliases = hclwrite.Tokens{
+			{Type: hclsyntax.TokenOBrack, Bytes: []byte("[")},
+		}
+		for index, alias := range p.ConfigurationAliases {
+			if index > 0 {
+				aliases = append(aliases, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+			}
+			aliases = append(aliases, &hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte(alias)})
+		}
+		aliases = append(aliases, &hclwrite.Token{Type: hclsyntax.TokenCBrack, Bytes: []byte("]")})
+		appendAttr("configuration_aliases", aliases)
+	}
+	tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+	return tokens
+}
+
+// TerraformCloud defines the cloud{} block within the terraform{} block, which
+// is written to the terraplate.tf file with its values evaluated as for
+// providers
+type TerraformCloud struct {
+	Body  hcl.Body `hcl:",remain"`
+	Block *hclwrite.Block
+}
+
+// TerraProviderMeta defines the provider_meta{} block within the terraform{}
+// block, which is written to the terraplate.tf file like the cloud{} block
+type TerraProviderMeta struct {
+	Name  string   `hcl:",label"`
+	Body  hcl.Body `hcl:",remain"`
+	Block *hclwrite.Block
+}
+
+func (t *Terrafile) mergeTerraformBlock(parent *Terrafile) {
+	if t.TerraformBlock == nil {
+		t.TerraformBlock = &TerraformBlock{}
+	}
+	block := t.TerraformBlock
+
+	if block.RequiredVersion == "" {
+		block.RequiredVersion = parent.TerraformBlock.RequiredVersion
+	}
+	if block.Experiments == nil {
+		block.Experiments = parent.TerraformBlock.Experiments
+	}
+	var requiredProviders = make(map[string]RequiredProvider)
+	for name, value := range block.RequiredProviders() {
+		requiredProviders[name] = value
+	}
+	// Merge the required providers by name, where any arguments that the child
+	// does not set are inherited from the parent
+	for name, parentValue := range parent.TerraformBlock.RequiredProviders() {
+		value, ok := requiredProviders[name]
+		if !ok {
+			requiredProviders[name] = parentValue
+			continue
+		}
+		if value.Source == "" {
+			value.Source = parentValue.Source
+		}
+		if value.Version == "" {
+			value.Version = parentValue.Version
+		}
+		if value.ConfigurationAliases == nil {
+			value.ConfigurationAliases = parentValue.ConfigurationAliases
+		}
+		requiredProviders[name] = value
+	}
+	block.RequiredProvidersBlock = &TerraRequiredProviders{
+		RequiredProviders: requiredProviders,
+	}
+
+	// Merge the cloud{} and provider_meta{} blocks, where child attributes
+	// override parent attributes by name
+	if parentCloud := parent.TerraformBlock.CloudBlock; parentCloud != nil {
+		cloud := &TerraformCloud{Body: parentCloud.Body}
+		if block.CloudBlock != nil {
+			cloud.Body = mergeBodies(syntaxBody(block.CloudBlock.Body), syntaxBody(parentCloud.Body))
+		}
+		block.CloudBlock = cloud
+	}
+	var metas = make([]*TerraProviderMeta, 0, len(block.ProviderMetas)+len(parent.TerraformBlock.ProviderMetas))
+	for _, meta := range block.ProviderMetas {
+		merged := *meta
+		if parentMeta := parent.TerraformBlock.providerMeta(meta.Name); parentMeta != nil {
+			merged.Body = mergeBodies(syntaxBody(meta.Body), syntaxBody(parentMeta.Body))
+		}
+		metas = append(metas, &merged)
+	}
+	for _, parentMeta := range parent.TerraformBlock.ProviderMetas {
+		if block.providerMeta(parentMeta.Name) == nil {
+			meta := *parentMeta
+			metas = append(metas, &meta)
+		}
+	}
+	block.ProviderMetas = metas
+}
+
+// resolveTerraformBlock creates the cloud{} and provider_meta{} blocks to
+// build
+func (t *Terrafile) resolveTerraformBlock(r *resolver) error {
+	if t.TerraformBlock == nil {
+		return nil
+	}
+	var diags hcl.Diagnostics
+	if cloud := t.TerraformBlock.CloudBlock; cloud != nil {
+		body := syntaxBody(cloud.Body)
+		cloud.Block = hclwrite.NewBlock("cloud", nil)
+		renderer := newBodyRenderer(r.evalCtx(filepath.Dir(body.SrcRange.Filename)))
+		diags = append(diags, renderer.render(cloud.Block.Body(), body)...)
+	}
+	for _, meta := range t.TerraformBlock.ProviderMetas {
+		body := syntaxBody(meta.Body)
+		meta.Block = hclwrite.NewBlock("provider_meta", []string{meta.Name})
+		renderer := newBodyRenderer(r.evalCtx(filepath.Dir(body.SrcRange.Filename)))
+		diags = append(diags, renderer.render(meta.Block.Body(), body)...)
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
+// traversalString returns a traversal as it would be written, e.g. aws.west
+func traversalString(traversal hcl.Traversal) string {
+	var str = traversal.RootName()
+	for _, traverser := range traversal[1:] {
+		if name, ok := traverserName(traverser); ok {
+			str += "." + name
+		}
+	}
+	return str
+}
@@ -0,0 +1,4 @@
+
+backend "s3" {
+  region = "eu-west-1"
+}
@@ -0,0 +1,4 @@
+
+backend "s3" {
+  key = "custom.tfstate"
+}
@@ -0,0 +1,9 @@
+
+values {
+  bucket = "bucket-name"
+}
+
+backend "s3" {
+  bucket      = values.bucket
+  key_pattern = "{{ .RelativeDir }}/terraform.tfstate"
+}
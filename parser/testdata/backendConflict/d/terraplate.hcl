@@ -0,0 +1,6 @@
+
+backend "s3" {
+  bucket = "state"
+  key    = "shared.tfstate"
+  region = "eu-central-1"
+}
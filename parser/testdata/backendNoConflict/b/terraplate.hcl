@@ -0,0 +1,4 @@
+
+locals {
+  name = "b"
+}
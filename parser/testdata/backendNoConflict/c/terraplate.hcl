@@ -0,0 +1,2 @@
+
+backend "local" {}
@@ -0,0 +1,5 @@
+
+backend "s3" {
+  bucket      = "state"
+  key_pattern = "{{ .RelativeDir }}/terraform.tfstate"
+}
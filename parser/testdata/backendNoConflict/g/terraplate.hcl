@@ -0,0 +1,5 @@
+
+# The key is given with -backend-config when initialising
+backend "s3" {
+  bucket = "state"
+}
@@ -0,0 +1,4 @@
+
+backend "local" {
+  path = "terraform.tfstate"
+}
@@ -0,0 +1,10 @@
+# Override the header, and inherit the json_header_key
+build {
+  header = "Managed by the child"
+}
+
+template "main" {
+  contents = "package main"
+  target   = "main.go"
+  header   = ""
+}
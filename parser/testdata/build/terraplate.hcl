@@ -0,0 +1,13 @@
+build {
+  header          = "Managed by {{ .Values.team }}"
+  json_header_key = "_comment"
+}
+
+values {
+  team = "platform"
+}
+
+template "config" {
+  contents = "{}"
+  target   = "config.json"
+}
@@ -0,0 +1,8 @@
+
+values {
+  tags = {
+    owner = "dev-team"
+    env   = "dev"
+  }
+  regions = ["eu-north-1"]
+}
@@ -0,0 +1,13 @@
+
+values {
+  tags = {
+    project = "terraplate"
+    owner   = "platform"
+  }
+  regions = ["eu-west-1"]
+}
+
+merge "values" {
+  strategy = "deep"
+  lists    = "append"
+}
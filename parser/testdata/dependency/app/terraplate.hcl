@@ -0,0 +1,7 @@
+dependency "network" {
+  path = "../network"
+  mock_outputs = {
+    vpc_id  = "vpc-mock"
+    subnets = ["subnet-a", "subnet-b"]
+  }
+}
@@ -0,0 +1,4 @@
+# Dependencies are not inherited, otherwise network would depend on itself
+exec {
+  depends_on = ["network"]
+}
@@ -0,0 +1,3 @@
+exec {
+  depends_on = ["../b"]
+}
@@ -0,0 +1,3 @@
+exec {
+  extra_args = ["-destroy"]
+}
@@ -0,0 +1,3 @@
+template "providers" {
+  enabled = false
+}
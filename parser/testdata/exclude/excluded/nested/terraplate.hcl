@@ -0,0 +1,4 @@
+# Excluded settings are not inherited by descendants either
+locals {
+  c = "c"
+}
@@ -0,0 +1,6 @@
+exclude {
+  templates = ["backend"]
+  locals    = ["b"]
+  variables = ["v2"]
+  values    = ["y"]
+}
@@ -0,0 +1,25 @@
+locals {
+  a = "a"
+  b = "b"
+}
+
+values {
+  x = "x"
+  y = "y"
+}
+
+variable "v1" {
+  default = "v1"
+}
+
+variable "v2" {
+  type = string
+}
+
+template "providers" {
+  contents = "# providers"
+}
+
+template "backend" {
+  contents = "# backend"
+}
@@ -0,0 +1,11 @@
+
+values {
+  profile = "dev"
+}
+
+exec {
+  env = {
+    TF_VAR_name  = "dev"
+    TF_LOG_LEVEL = 1
+  }
+}
@@ -0,0 +1,13 @@
+
+values {
+  profile = "default"
+}
+
+exec {
+  binary = "tofu"
+
+  env = {
+    AWS_PROFILE = values.profile
+    TF_VAR_name = "parent"
+  }
+}
@@ -0,0 +1,12 @@
+
+values {
+  env = "dev"
+}
+
+locals {
+  prefix = values.env
+}
+
+variables {
+  region = "eu-west-1"
+}
@@ -0,0 +1,11 @@
+
+values {
+  project = "terraplate"
+  # env is defined by the child Terrafile
+  bucket = "${values.project}-${values.env}-state"
+}
+
+locals {
+  bucket = values.bucket
+  name   = "${local.prefix}-${var.region}"
+}
@@ -0,0 +1,27 @@
+
+locals {
+  upper  = upper(local.name)
+  joined = join("-", concat([local.name], split(",", "a,b")))
+  merged = merge({ a = 1 }, { b = 2 })
+  lookup = lookup({ key = "value" }, "key", "default")
+  format = format("%s-%s", local.name, basename(relative_dir()))
+  home   = env("TERRAPLATE_TEST_ENV")
+  dir    = dirname(abspath("file.txt")) == root_dir() ? "root" : basename(dirname(abspath("file.txt")))
+  number = tonumber("3") + 1
+  string = tostring(true)
+  set    = length(toset(["a", "a", "b"]))
+  index  = index(["a", "b", "c"], "b")
+  try    = try(tonumber("not a number"), 0)
+  can    = can(regex("^eu-", "us-east-1"))
+  diff   = sort(setsymmetricdifference(["a", "b"], ["b", "c"]))
+  starts = startswith(local.name, "terra")
+  ends   = endswith(local.name, "form")
+  all    = alltrue([true, local.name == "terraplate"])
+  any    = anytrue([false, false])
+  sum    = sum([1, 2, 3.5])
+  one    = one(["only"])
+  none   = one([])
+  base64 = base64decode(base64encode(local.name))
+  exists = fileexists("terraplate.hcl")
+  absent = fileexists("missing.txt")
+}
@@ -0,0 +1,4 @@
+
+variables {
+  key = "value"
+}
@@ -0,0 +1,9 @@
+
+terraform {
+  required_providers {
+    local = {
+      source  = "hashicorp/local"
+      version = "2.1.0"
+    }
+  }
+}
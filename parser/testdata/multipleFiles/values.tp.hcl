@@ -0,0 +1,4 @@
+
+values {
+  key = "value"
+}
@@ -0,0 +1,4 @@
+
+exec {
+  skip = true
+}
@@ -0,0 +1,9 @@
+
+values {
+  zone = "a"
+  key  = "a"
+}
+
+locals {
+  name = "a"
+}
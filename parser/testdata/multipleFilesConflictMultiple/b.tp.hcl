@@ -0,0 +1,9 @@
+
+values {
+  zone = "b"
+  key  = "b"
+}
+
+locals {
+  name = "b"
+}
@@ -0,0 +1,4 @@
+
+variables {
+  region = "eu-west-1"
+}
@@ -0,0 +1,10 @@
+
+locals {
+  key = "child"
+}
+
+exec {
+  plan {
+    out = "child.tfplan"
+  }
+}
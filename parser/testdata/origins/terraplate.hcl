@@ -0,0 +1,16 @@
+
+locals {
+  key = "origins"
+}
+
+template "main" {
+  contents = "main"
+}
+
+exec {
+  depends_on = ["network"]
+}
+
+dependency "network" {
+  path = "network"
+}
@@ -0,0 +1,4 @@
+# Override the partial, which is used by the inherited template
+partial "tags" {
+  contents = "project = \"{{ template \"name\" . }}\", env = \"dev\""
+}
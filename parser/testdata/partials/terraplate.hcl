@@ -0,0 +1,17 @@
+partial "tags" {
+  contents = "project = \"{{ .Values.project }}\""
+}
+
+partial "name" {
+  contents = "{{ .Values.project }}"
+}
+
+values {
+  project = "terraplate"
+}
+
+template "tags" {
+  contents = <<-EOL
+    tags = { {{ template "tags" . }} }
+  EOL
+}
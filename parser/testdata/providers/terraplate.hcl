@@ -0,0 +1,15 @@
+
+values {
+  regions = ["eu-west-1", "us-east-1"]
+}
+
+provider "aws" {
+  region  = "eu-west-1"
+  profile = var.profile
+}
+
+provider "aws" {
+  for_each = values.regions
+  alias    = each.key
+  region   = each.value
+}
@@ -0,0 +1,12 @@
+
+terraform {
+  required_providers {
+    aws = {
+      version = ">= 4.0.0"
+    }
+  }
+
+  provider_meta "aws" {
+    module_name = "dev"
+  }
+}
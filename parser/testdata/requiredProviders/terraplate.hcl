@@ -0,0 +1,14 @@
+
+terraform {
+  required_providers {
+    aws = {
+      source                = "hashicorp/aws"
+      configuration_aliases = [aws.west]
+    }
+    random = "3.1.0"
+  }
+
+  cloud {
+    organization = "org"
+  }
+}
@@ -0,0 +1,3 @@
+
+# This directory only contains shared configuration and is never a root module
+root_module = false
@@ -0,0 +1,3 @@
+
+# This directory is a root module, even though it has child Terrafiles
+root_module = true
@@ -0,0 +1,5 @@
+
+template "invalid" {
+  contents  = "invalid"
+  condition = "{{ .Nope }}"
+}
@@ -0,0 +1,21 @@
+locals {
+  teams = {
+    platform = "platform@example.com"
+    data     = "data@example.com"
+  }
+}
+
+values {
+  regions = ["eu-west-1", "us-east-1"]
+}
+
+template "team" {
+  for_each = local.teams
+  contents = "{{ .Each.Key }} = {{ .Each.Value }}"
+}
+
+template "region" {
+  for_each = values.regions
+  contents = "{{ .Each.Value }}"
+  target   = "regions/{{ .Each.Key }}.txt"
+}
@@ -0,0 +1,6 @@
+
+values {
+  env      = jsondecode(file("env.json")).env
+  tfvars   = values_file("env.tfvars")
+  yamlfile = yamldecode(file("../common.yaml"))
+}
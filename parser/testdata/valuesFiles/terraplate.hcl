@@ -0,0 +1,5 @@
+
+values {
+  # Found by looking up the directory tree from the Terrafile that uses it
+  common = values_file("common.yaml")
+}
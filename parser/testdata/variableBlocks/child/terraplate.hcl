@@ -0,0 +1,5 @@
+
+# Override the default of the inherited variable declaration
+variables {
+  region = "eu-north-1"
+}
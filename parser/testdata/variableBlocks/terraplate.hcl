@@ -0,0 +1,10 @@
+
+variable "region" {
+  type        = string
+  description = "The region to deploy to"
+  default     = "eu-west-1"
+}
+
+variable "required" {
+  type = string
+}
@@ -0,0 +1,8 @@
+
+variable "region" {
+  type = string
+}
+
+variable "region" {
+  default = "eu-north-1"
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/verifa/terraplate/builder"
@@ -31,6 +35,10 @@ func (t terraCmd) Action() string {
 		return "summarizing"
 	case terraShowJSON:
 		return "summarizing"
+	case terraVersion:
+		return "checking version"
+	case terraOutput:
+		return "reading outputs"
 	}
 	return "Unknown action"
 }
@@ -45,6 +53,7 @@ func (t terraCmd) Cmd() string {
 }
 
 const (
+	// terraExe is the default terraform binary
 	terraExe = "terraform"
 
 	terraBuild    terraCmd = "build"
@@ -57,6 +66,12 @@ const (
 	// terraShowJSON is used to run `terraform show -json` to provide machine
 	// readable output
 	terraShowJSON terraCmd = "showPlan"
+	// terraVersion is used to run `terraform version -json` to check that the
+	// terraform version satisfies the required_version
+	terraVersion terraCmd = "version"
+	// terraOutput is used to run `terraform output -json` to read the outputs
+	// of a dependency
+	terraOutput terraCmd = "output"
 )
 
 func buildCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
@@ -69,7 +84,7 @@ func buildCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 func validateCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 	var args []string
 	args = append(args, tfCleanExtraArgs(opts.extraArgs)...)
-	return runCmd(opts.out, tf, terraValidate, args)
+	return runCmd(opts, tf, terraValidate, args)
 }
 
 func initCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
@@ -78,7 +93,7 @@ func initCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 		args = append(args, "-upgrade")
 	}
 	args = append(args, tfCleanExtraArgs(opts.extraArgs)...)
-	return runCmd(opts.out, tf, terraInit, args)
+	return runCmd(opts, tf, terraInit, args)
 }
 
 func planCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
@@ -96,7 +111,7 @@ func planCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 	}
 	args = append(args, tfCleanExtraArgs(tf.ExecBlock.ExtraArgs)...)
 	args = append(args, tfCleanExtraArgs(opts.extraArgs)...)
-	return runCmd(opts.out, tf, terraPlan, args)
+	return runCmd(opts, tf, terraPlan, args)
 }
 
 func showPlanCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
@@ -109,7 +124,7 @@ func showPlanCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 	}
 	var args []string
 	args = append(args, "-json", plan.Out)
-	return runCmd(opts.out, tf, terraShowJSON, args)
+	return runCmd(opts, tf, terraShowJSON, args)
 }
 
 func showCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
@@ -122,10 +137,24 @@ func showCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 	}
 	var args []string
 	args = append(args, plan.Out)
-	return runCmd(opts.out, tf, terraShow, args)
+	return runCmd(opts, tf, terraShow, args)
 }
 
 func applyCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
+	// Do not apply a plan that was built with the mock outputs of dependencies
+	mocked, mockErr := builder.MockedDependencies(tf)
+	if mockErr != nil {
+		return &TaskResult{
+			TerraCmd: terraApply,
+			Error:    fmt.Errorf("%s: %w", tf.Dir, mockErr),
+		}
+	}
+	if len(mocked) > 0 {
+		return &TaskResult{
+			TerraCmd: terraApply,
+			Error:    fmt.Errorf("%s: the last build used the mock_outputs of dependencies %s: build and plan again once they have been applied, or set mock_outputs_allowed_on_apply", tf.Dir, strings.Join(mocked, ", ")),
+		}
+	}
 	plan := tf.ExecBlock.PlanBlock
 
 	var args []string
@@ -140,20 +169,28 @@ func applyCmd(opts TerraRunOpts, tf *parser.Terrafile) *TaskResult {
 		args = append(args, plan.Out)
 	}
 
-	return runCmd(opts.out, tf, terraApply, args)
+	return runCmd(opts, tf, terraApply, args)
+}
+
+func runCmd(opts TerraRunOpts, tf *parser.Terrafile, tfCmd terraCmd, args []string) *TaskResult {
+	return runCmdInDir(opts, tf, tf.Dir, tfCmd, args)
 }
 
-func runCmd(out io.Writer, tf *parser.Terrafile, tfCmd terraCmd, args []string) *TaskResult {
+// runCmdInDir runs the terraform command for the terrafile in the given
+// directory, which is only different from the directory of the terrafile when
+// reading the outputs of a dependency
+func runCmdInDir(opts TerraRunOpts, tf *parser.Terrafile, dir string, tfCmd terraCmd, args []string) *TaskResult {
 	task := TaskResult{
 		TerraCmd: tfCmd,
 	}
-	cmdArgs := append(tfArgs(tf), tfCmd.Cmd())
+	cmdArgs := append(tfArgs(dir), tfCmd.Cmd())
 	cmdArgs = append(cmdArgs, args...)
-	task.ExecCmd = exec.Command(terraExe, cmdArgs...)
+	task.ExecCmd = exec.Command(tfBinary(opts, tf), cmdArgs...)
+	task.ExecCmd.Env = tfEnv(tf)
 
 	// Create channel and start progress printer
 	done := make(chan bool)
-	go printProgress(out, tf.Dir, tfCmd, done)
+	go printProgress(opts.out, tf.Dir, tfCmd, done)
 	defer func() { done <- true }()
 
 	pr, pw := io.Pipe()
@@ -165,13 +202,18 @@ func runCmd(out io.Writer, tf *parser.Terrafile, tfCmd terraCmd, args []string)
 		task.Error = fmt.Errorf("starting command: %w", err)
 		return &task
 	}
+	copied := make(chan struct{})
 	go func() {
+		defer close(copied)
 		if _, err := io.Copy(&task.Output, pr); err != nil {
 			log.Fatal(err)
 		}
 	}()
 
 	runErr := task.ExecCmd.Wait()
+	// Wait for all the output to be copied, as it is parsed by some commands
+	pw.Close()
+	<-copied
 	if runErr != nil {
 		task.Error = fmt.Errorf("%s: running %s command", tf.Dir, tfCmd)
 	}
@@ -179,12 +221,51 @@ func runCmd(out io.Writer, tf *parser.Terrafile, tfCmd terraCmd, args []string)
 	return &task
 }
 
-func tfArgs(tf *parser.Terrafile) []string {
+// tfBinary returns the terraform binary to use for the terrafile. The binary
+// from the options takes precedence over the binary from the exec block.
+// Unless the binary is a path, the newest installed version that satisfies the
+// required_version is used, falling back to the binary on the PATH
+func tfBinary(opts TerraRunOpts, tf *parser.Terrafile) string {
+	binary := terraExe
+	switch {
+	case opts.terraformBinary != "":
+		binary = opts.terraformBinary
+	case tf.ExecBlock != nil && tf.ExecBlock.Binary != "":
+		binary = tf.ExecBlock.Binary
+	}
+	if strings.ContainsRune(binary, filepath.Separator) {
+		return binary
+	}
+	if installed := installedBinary(binary, tf); installed != "" {
+		return installed
+	}
+	return binary
+}
+
+func tfArgs(dir string) []string {
 	var args []string
-	args = append(args, "-chdir="+tf.Dir)
+	args = append(args, "-chdir="+dir)
 	return args
 }
 
+// tfEnv returns the environment for running terraform, which is the
+// environment of this process with the variables from the exec block added
+func tfEnv(tf *parser.Terrafile) []string {
+	env := os.Environ()
+	if tf.ExecBlock == nil {
+		return env
+	}
+	var names = make([]string, 0, len(tf.ExecBlock.Env))
+	for name := range tf.ExecBlock.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+tf.ExecBlock.Env[name])
+	}
+	return env
+}
+
 // tfCleanExtraArgs returns the provided slice with any empty spaces removed.
 // Empty spaces create weird errors that are hard to debug
 func tfCleanExtraArgs(args []string) []string {
@@ -72,10 +72,19 @@ func ExtraArgs(extraArgs []string) func(r *TerraRunOpts) {
 	}
 }
 
+// TerraformBinary sets the terraform binary to use, e.g. tofu for OpenTofu.
+// It takes precedence over the binary set in the exec block of a Terrafile
+func TerraformBinary(binary string) func(r *TerraRunOpts) {
+	return func(r *TerraRunOpts) {
+		r.terraformBinary = binary
+	}
+}
+
 func FromOpts(opts TerraRunOpts) func(r *TerraRunOpts) {
 	return func(r *TerraRunOpts) {
 		r.jobs = opts.jobs
 		r.out = opts.out
+		r.terraformBinary = opts.terraformBinary
 	}
 }
 
@@ -112,4 +121,27 @@ type TerraRunOpts struct {
 	jobs int
 	// Terraform command flags
 	extraArgs []string
+	// terraformBinary overrides the terraform binary to use
+	terraformBinary string
+}
+
+// runsTerraform returns true if the options require running terraform
+func (r TerraRunOpts) runsTerraform() bool {
+	return r.init || r.validate || r.plan || r.show || r.showPlan || r.apply
+}
+
+// destroys returns true if the extra args make terraform plan or apply destroy
+// the resources, in which case root modules run before the root modules they
+// depend on
+func (r TerraRunOpts) destroys() bool {
+	if !r.plan && !r.apply {
+		return false
+	}
+	for _, arg := range r.extraArgs {
+		switch arg {
+		case "-destroy", "--destroy", "-destroy=true", "--destroy=true":
+			return true
+		}
+	}
+	return false
 }
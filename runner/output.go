@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/verifa/terraplate/parser"
+)
+
+// outputValue is a single output from `terraform output -json`
+type outputValue struct {
+	Value interface{} `json:"value"`
+}
+
+// outputCmd reads the outputs of a dependency of the terrafile, so that they
+// can be used when building the terrafile.
+// If the outputs cannot be read, e.g. because the dependency has not been
+// initialized, or the dependency has no outputs because it has not been
+// applied yet, the mock outputs of the dependency are used instead.
+// Reading the outputs only fails if the dependency has no mock outputs
+func outputCmd(opts TerraRunOpts, tf *parser.Terrafile, dep *parser.TerraDependency) *TaskResult {
+	// Run terraform with the settings of the dependency if it was parsed, e.g.
+	// to use the same binary and environment variables
+	depTf := dep.Module()
+	if depTf == nil {
+		depTf = tf
+	}
+	dep.Outputs = nil
+	task := runCmdInDir(opts, depTf, dep.Dir, terraOutput, []string{"-json"})
+	if task.HasError() {
+		if dep.HasMockOutputs() {
+			task.Error = nil
+			return useMockOutputs(opts, task, tf, dep, "could not read outputs")
+		}
+		task.Error = fmt.Errorf("%s: reading outputs of dependency \"%s\": %w", tf.Dir, dep.Name, task.Error)
+		return task
+	}
+	var outputs map[string]outputValue
+	if err := json.Unmarshal(task.Output.Bytes(), &outputs); err != nil {
+		task.Error = fmt.Errorf("%s: parsing outputs of dependency \"%s\": %w", tf.Dir, dep.Name, err)
+		return task
+	}
+	// Without state, terraform succeeds and returns no outputs
+	if len(outputs) == 0 {
+		return useMockOutputs(opts, task, tf, dep, "has no outputs")
+	}
+	dep.Outputs = make(map[string]interface{}, len(outputs))
+	for name, output := range outputs {
+		dep.Outputs[name] = output.Value
+	}
+	return task
+}
+
+// useMockOutputs makes the task use the mock outputs of the dependency, or sets
+// an error on the task if the dependency has no mock outputs. The reason is why
+// the outputs of the dependency are not available.
+// Mock outputs are not used when applying, unless the dependency allows it
+func useMockOutputs(opts TerraRunOpts, task *TaskResult, tf *parser.Terrafile, dep *parser.TerraDependency, reason string) *TaskResult {
+	if !dep.HasMockOutputs() {
+		task.Error = fmt.Errorf("%s: dependency \"%s\" has no outputs and no mock_outputs: has %s been applied?", tf.Dir, dep.Name, dep.Dir)
+		return task
+	}
+	if opts.apply && !dep.MockOutputsAllowedOnApply {
+		task.Error = fmt.Errorf("%s: dependency \"%s\" %s: has %s been applied? mock_outputs are only used when applying if mock_outputs_allowed_on_apply is true", tf.Dir, dep.Name, reason, dep.Dir)
+		return task
+	}
+	fmt.Fprintf(&task.Output, "\nDependency \"%s\" %s: using mock_outputs\n", dep.Name, reason)
+	return task
+}
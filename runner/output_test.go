@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/verifa/terraplate/parser"
+)
+
+// testDependency creates an app root module with the given dependency on a
+// network root module in a temporary directory, and returns the directory and
+// the app
+func testDependency(t *testing.T, dependency string) (string, *parser.Terrafile) {
+	root := t.TempDir()
+	for dir, contents := range map[string]string{
+		"network": "",
+		"app":     "dependency \"network\" {\n" + dependency + "\n}\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(root, dir, "terraplate.hcl"), []byte(contents), 0644))
+	}
+	config, err := parser.Parse(&parser.Config{
+		Chdir: root,
+	})
+	require.NoError(t, err)
+	for _, tf := range config.RootModules() {
+		if filepath.Base(tf.Dir) == "app" {
+			require.Len(t, tf.Dependencies, 1)
+			return root, tf
+		}
+	}
+	t.Fatal("app root module not found")
+	return "", nil
+}
+
+func TestOutputCmd(t *testing.T) {
+	tests := map[string]struct {
+		// script is the fake terraform binary for `terraform output -json`
+		script     string
+		dependency string
+		opts       []func(r *TerraRunOpts)
+		outputs    map[string]interface{}
+		mock       bool
+		err        string
+	}{
+		"outputs": {
+			script:  `echo '{"vpc_id": {"value": "vpc-123", "type": "string"}}'`,
+			outputs: map[string]interface{}{"vpc_id": "vpc-123"},
+		},
+		"no outputs": {
+			script: `echo '{}'`,
+			mock:   true,
+		},
+		"no outputs and no mock_outputs": {
+			script:     `echo '{}'`,
+			dependency: `path = "../network"`,
+			err:        "has no outputs and no mock_outputs",
+		},
+		"command fails": {
+			script: `echo 'Error: Backend initialization required' >&2; exit 1`,
+			mock:   true,
+		},
+		"command fails and no mock_outputs": {
+			script:     `echo 'Error: Backend initialization required' >&2; exit 1`,
+			dependency: `path = "../network"`,
+			err:        "reading outputs of dependency \"network\"",
+		},
+		"command fails when applying": {
+			script: `echo 'Error: Backend initialization required' >&2; exit 1`,
+			opts:   []func(r *TerraRunOpts){RunApply()},
+			err:    "could not read outputs: has",
+		},
+		"no outputs when applying": {
+			script: `echo '{}'`,
+			opts:   []func(r *TerraRunOpts){RunApply()},
+			err:    "mock_outputs are only used when applying if mock_outputs_allowed_on_apply is true",
+		},
+		"no outputs when applying and allowed": {
+			script:     `echo '{}'`,
+			dependency: "path = \"../network\"\nmock_outputs = { vpc_id = \"vpc-mock\" }\nmock_outputs_allowed_on_apply = true",
+			opts:       []func(r *TerraRunOpts){RunApply()},
+			mock:       true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dependency := tc.dependency
+			if dependency == "" {
+				dependency = "path = \"../network\"\nmock_outputs = { vpc_id = \"vpc-mock\" }"
+			}
+			root, app := testDependency(t, dependency)
+			binary := filepath.Join(root, "terraform")
+			require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\n"+tc.script+"\n"), 0755))
+			dep := app.Dependencies[0]
+
+			opts := NewOpts(append(tc.opts, TerraformBinary(binary), Output(io.Discard))...)
+			task := outputCmd(opts, app, dep)
+			if tc.err != "" {
+				require.Error(t, task.Error)
+				assert.Contains(t, task.Error.Error(), tc.err)
+				return
+			}
+			require.NoError(t, task.Error)
+			assert.Equal(t, tc.outputs, dep.Outputs)
+			data, err := app.BuildData()
+			require.NoError(t, err)
+			if tc.mock {
+				assert.Contains(t, task.Output.String(), "using mock_outputs")
+				assert.Equal(t, map[string]interface{}{"network": map[string]interface{}{"vpc_id": "vpc-mock"}}, data.Dependencies)
+				return
+			}
+			assert.Equal(t, map[string]interface{}{"network": tc.outputs}, data.Dependencies)
+		})
+	}
+}
+
+func TestApplyMockOutputs(t *testing.T) {
+	_, app := testDependency(t, "path = \"../network\"\nmock_outputs = { vpc_id = \"vpc-mock\" }")
+
+	// Building with the mock outputs prevents applying the plan
+	opts := NewOpts(TerraformBinary("/bin/true"), Output(io.Discard))
+	require.NoError(t, buildCmd(opts, app).Error)
+	task := applyCmd(opts, app)
+	require.Error(t, task.Error)
+	assert.Contains(t, task.Error.Error(), "the last build used the mock_outputs of dependencies network")
+
+	// Once the outputs are available, the plan can be applied
+	app.Dependencies[0].Outputs = map[string]interface{}{"vpc_id": "vpc-123"}
+	require.NoError(t, buildCmd(opts, app).Error)
+	task = applyCmd(opts, app)
+	assert.NoError(t, task.Error)
+}
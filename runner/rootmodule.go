@@ -30,30 +30,32 @@ type RootModule struct {
 	mu  sync.RWMutex
 }
 
-// ScheduleRun schedules a run on the RootModule by setting the state and
-// adding to the waitgroup.
+// newRun sets a new run on the RootModule. The Runner adds it to the run queue,
+// so that runs are not sent once the queue has been closed.
 // If a run is already in progress an error is returned and the state is unchanged
-func (r *RootModule) ScheduleRun(runQueue chan *TerraRun) error {
-	return r.ScheduleRunWithOpts(runQueue, r.Opts)
-}
-
-// ScheduleRun schedules a run on the RootModule by setting the state and
-// adding to the waitgroup.
-// If a run is already in progress an error is returned and the state is unchanged
-func (r *RootModule) ScheduleRunWithOpts(runQueue chan *TerraRun, opts TerraRunOpts) error {
+func (r *RootModule) newRun(opts TerraRunOpts) (*TerraRun, error) {
 	// Don't schedule runs for modules that should be skipped
 	if r.Skip() {
-		return ErrRunSkipped
+		return nil, ErrRunSkipped
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if r.Run != nil && r.Run.IsRunning() {
-		return ErrRunInProgress
+		return nil, ErrRunInProgress
 	}
 	newRun := newRunForQueue(r.Terrafile, opts)
 	r.Run = newRun
-	runQueue <- newRun
+	return newRun, nil
+}
+
+// currentRun returns the run of the RootModule if one is in progress
+func (r *RootModule) currentRun() *TerraRun {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.Run != nil && r.Run.IsRunning() {
+		return r.Run
+	}
 	return nil
 }
 
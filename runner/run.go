@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/hashicorp/go-version"
 	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/verifa/terraplate/parser"
 )
@@ -36,10 +37,17 @@ type TerraRun struct {
 
 	Tasks     []*TaskResult
 	Cancelled bool
+	// FailedDependency is set if the run was skipped because a root module
+	// that it depends on did not run successfully or, when destroying, a root
+	// module that depends on it
+	FailedDependency *parser.Terrafile
 
 	Plan     *tfjson.Plan
 	PlanText []byte
 
+	// TerraformVersion is the version of the terraform binary used for the run
+	TerraformVersion *version.Version
+
 	drift *Drift
 
 	wg    sync.WaitGroup
@@ -60,36 +68,53 @@ func (r *TerraRun) Start() {
 	tf := r.Terrafile
 
 	if r.Opts.build {
+		// Read the outputs of the dependencies, which are used when building
+		for _, dep := range tf.Dependencies {
+			taskResult := outputCmd(r.Opts, tf, dep)
+			r.addTask(taskResult)
+			if taskResult.HasError() {
+				return
+			}
+		}
 		taskResult := buildCmd(r.Opts, tf)
 		r.Tasks = append(r.Tasks, taskResult)
 		if taskResult.HasError() {
 			return
 		}
 	}
+	// Check the terraform version before running any terraform commands
+	if r.Opts.runsTerraform() {
+		taskResult, tfVersion := versionCmd(r.Opts, tf)
+		r.TerraformVersion = tfVersion
+		r.addTask(taskResult)
+		if taskResult.HasError() {
+			return
+		}
+	}
 	if r.Opts.init {
 		taskResult := initCmd(r.Opts, tf)
-		r.Tasks = append(r.Tasks, taskResult)
+		r.addTask(taskResult)
 		if taskResult.HasError() {
 			return
 		}
 	}
 	if r.Opts.validate {
 		taskResult := validateCmd(r.Opts, tf)
-		r.Tasks = append(r.Tasks, taskResult)
+		r.addTask(taskResult)
 		if taskResult.HasError() {
 			return
 		}
 	}
 	if r.Opts.plan {
 		taskResult := planCmd(r.Opts, tf)
-		r.Tasks = append(r.Tasks, taskResult)
+		r.addTask(taskResult)
 		if taskResult.HasError() {
 			return
 		}
 	}
 	if r.Opts.show {
 		taskResult := showCmd(r.Opts, tf)
-		r.Tasks = append(r.Tasks, taskResult)
+		r.addTask(taskResult)
 		if taskResult.HasError() {
 			return
 		}
@@ -97,20 +122,29 @@ func (r *TerraRun) Start() {
 	if r.Opts.showPlan {
 		taskResult := showPlanCmd(r.Opts, tf)
 		r.ProcessPlan(taskResult)
-		r.Tasks = append(r.Tasks, taskResult)
+		r.addTask(taskResult)
 		if taskResult.HasError() {
 			return
 		}
 	}
 	if r.Opts.apply {
 		taskResult := applyCmd(r.Opts, tf)
-		r.Tasks = append(r.Tasks, taskResult)
+		r.addTask(taskResult)
 		if taskResult.HasError() {
 			return
 		}
 	}
 }
 
+// addTask adds a task result to the run, recording the version of the
+// terraform binary that ran it
+func (r *TerraRun) addTask(task *TaskResult) {
+	if task.TerraCmd != terraBuild {
+		task.Version = r.TerraformVersion
+	}
+	r.Tasks = append(r.Tasks, task)
+}
+
 // Wait blocks and waits for the run to be finished
 func (r *TerraRun) Wait() {
 	r.wg.Wait()
@@ -140,13 +174,27 @@ func (r *TerraRun) Log(fullLog bool) string {
 	return log.String()
 }
 
-// Summary returns a string summary to show after a plan
+// Summary returns a string summary to show after a plan, including the version
+// of the terraform binary if it was detected
 func (r *TerraRun) Summary() string {
+	summary := r.statusSummary()
+	if r.TerraformVersion != nil {
+		summary += fmt.Sprintf(" (version %s)", r.TerraformVersion)
+	}
+	return summary
+}
+
+func (r *TerraRun) statusSummary() string {
 	switch {
 	case r.HasError():
 		return errorColor.Sprint("Error occurred")
 	case r.Cancelled:
 		return runCancelled.Sprint("Cancelled")
+	case r.FailedDependency != nil:
+		if r.Opts.destroys() {
+			return runCancelled.Sprintf("Skipped: dependent %s did not run successfully", r.FailedDependency.Dir)
+		}
+		return runCancelled.Sprintf("Skipped: dependency %s did not run successfully", r.FailedDependency.Dir)
 	case r.IsApplied():
 		return boldColor.Sprint("Applied")
 	case r.IsPlanned():
@@ -27,15 +27,16 @@ func Run(config *parser.TerraConfig, opts ...func(r *TerraRunOpts)) *Runner {
 func New(config *parser.TerraConfig, opts ...func(r *TerraRunOpts)) *Runner {
 	runOpts := NewOpts(opts...)
 
-	// Create the runQueue which is used by the workers to schedule runs
-	runQueue := make(chan *TerraRun, maxRunQueue)
-
+	ctx, cancel := context.WithCancel(context.Background())
 	runner := Runner{
-		ctx:      listenTerminateSignals(runQueue),
-		runQueue: runQueue,
+		ctx:       ctx,
+		cancelCtx: cancel,
+		// Create the runQueue which is used by the workers to schedule runs
+		runQueue: make(chan *TerraRun, maxRunQueue),
 		config:   config,
 		Opts:     runOpts,
 	}
+	runner.listenTerminateSignals()
 	// Initialize the workers in separate go routines
 	for workerID := 0; workerID < runOpts.jobs; workerID++ {
 		go runner.startWorker(workerID)
@@ -55,10 +56,14 @@ func New(config *parser.TerraConfig, opts ...func(r *TerraRunOpts)) *Runner {
 }
 
 type Runner struct {
-	ctx context.Context
+	ctx       context.Context
+	cancelCtx context.CancelFunc
 	// runQueue is a channel for managing the run queue
 	runQueue chan *TerraRun
-	wg       sync.WaitGroup
+	// queueMu makes sure that no runs are added to the run queue once it has
+	// been closed
+	queueMu sync.Mutex
+	wg      sync.WaitGroup
 
 	config *parser.TerraConfig
 
@@ -83,15 +88,68 @@ func (r *Runner) Start(modules []*RootModule) {
 	r.StartWithOpts(modules, r.Opts)
 }
 
+// StartWithOpts schedules runs for the given modules. Modules that depend on
+// other root modules that are running are only scheduled once the runs of
+// their dependencies have finished successfully.
+// When destroying, the order is reversed so that a module is only destroyed
+// once the modules that depend on it have been destroyed
 func (r *Runner) StartWithOpts(modules []*RootModule, opts TerraRunOpts) {
+	// Create all the runs first, so that runs can wait for the runs of their
+	// dependencies regardless of the order of the modules
+	var runs = make([]*TerraRun, 0, len(modules))
 	for _, mod := range modules {
 		// Check that the run is not in progress
-		if runErr := mod.ScheduleRunWithOpts(r.runQueue, opts); runErr != nil {
+		run, runErr := mod.newRun(opts)
+		if runErr != nil {
 			continue
 		}
 		// If run was scheduled, add to waitgroup
 		r.wg.Add(1)
+		runs = append(runs, run)
+	}
+	// Find the dependencies of all the runs before queueing any of them, as
+	// the state of the runs changes once they start
+	var deps = make([][]*TerraRun, len(runs))
+	for index, run := range runs {
+		deps[index] = r.dependencyRuns(run.Terrafile, opts.destroys())
+	}
+	for index, run := range runs {
+		if len(deps[index]) == 0 {
+			r.enqueue(run)
+			continue
+		}
+		go r.scheduleAfter(run, deps[index])
+	}
+}
+
+// dependencyRuns returns the runs in progress for the root modules that the
+// terrafile depends on or, when destroying, for the root modules that depend
+// on the terrafile
+func (r *Runner) dependencyRuns(tf *parser.Terrafile, destroy bool) []*TerraRun {
+	var runs []*TerraRun
+	for _, mod := range r.Modules {
+		waitFor := dependsOn(tf, mod.Terrafile)
+		if destroy {
+			waitFor = dependsOn(mod.Terrafile, tf)
+		}
+		if !waitFor {
+			continue
+		}
+		if run := mod.currentRun(); run != nil {
+			runs = append(runs, run)
+		}
 	}
+	return runs
+}
+
+// dependsOn returns true if the terrafile depends on the other terrafile
+func dependsOn(tf *parser.Terrafile, other *parser.Terrafile) bool {
+	for _, dep := range tf.DependsOn() {
+		if dep == other {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *Runner) Wait() {
@@ -142,7 +200,7 @@ func (r *Runner) Summary(level OutputLevel) string {
 	)
 	summary.WriteString(boldColor.Sprint("\nTerraplate Summary\n\n"))
 	for _, run := range r.Runs() {
-		showSummary := level.ShowAll() || (run.Drift().HasDrift() && level.ShowDrift()) || run.HasError()
+		showSummary := level.ShowAll() || (run.Drift().HasDrift() && level.ShowDrift()) || run.HasError() || run.FailedDependency != nil
 
 		if showSummary {
 			hasRelevantRuns = true
@@ -208,11 +266,9 @@ func (r *Runner) Errors() error {
 	return err
 }
 
-// listenTerminateSignals returns a context that will be cancelled if an interrupt
-// or termination signal is received. The context can be used to prevent further
-// runs from being scheduled
-func listenTerminateSignals(runQueue chan *TerraRun) context.Context {
-	ctx, cancel := context.WithCancel(context.Background())
+// listenTerminateSignals cancels the runner if an interrupt or termination
+// signal is received, to prevent further runs from being executed
+func (r *Runner) listenTerminateSignals() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
@@ -222,10 +278,40 @@ func listenTerminateSignals(runQueue chan *TerraRun) context.Context {
 			fmt.Println("Terraplate: Interrupt received.")
 			fmt.Println("Terraplate: Sending interrupt to all Terraform processes and cancelling any queued runs.")
 			fmt.Println("")
-			// Cancel the context and stop any more runs from being executed
-			cancel()
-			close(runQueue)
+			r.cancel()
 		}
 	}()
-	return ctx
+}
+
+// cancel cancels the context and closes the run queue, so that the runs in the
+// queue are cancelled and no more runs are executed
+func (r *Runner) cancel() {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+	// Closing the run queue twice would panic
+	if r.ctx.Err() != nil {
+		return
+	}
+	r.cancelCtx()
+	close(r.runQueue)
+}
+
+// enqueue adds the run to the run queue, or cancels the run if the runner has
+// been cancelled and the run queue is closed
+func (r *Runner) enqueue(run *TerraRun) {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+	if r.ctx.Err() != nil {
+		r.cancelRun(run)
+		return
+	}
+	r.runQueue <- run
+}
+
+// cancelRun ends a run that will not be executed because the runner has been
+// cancelled
+func (r *Runner) cancelRun(run *TerraRun) {
+	run.Cancelled = true
+	run.endRun()
+	r.wg.Done()
 }
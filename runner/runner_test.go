@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/verifa/terraplate/parser"
+)
+
+// fakeTerraform is a terraform binary for the tests. It logs each command to
+// the log file in the root directory, fails if a fail_<module> file exists and
+// blocks if a block_<module> file exists until a release file exists
+const fakeTerraform = `#!/bin/sh
+root="%s"
+module=$(basename "${1#-chdir=}")
+if [ "$2" = "version" ]; then
+  echo '{"terraform_version": "1.3.9"}'
+  exit 0
+fi
+if [ -f "$root/block_$module" ]; then
+  touch "$root/started_$module"
+  while [ ! -f "$root/release" ]; do sleep 0.01; done
+fi
+if [ -f "$root/slow_$module" ]; then
+  sleep 0.2
+fi
+echo "$module $2" >> "$root/log"
+if [ -f "$root/fail_$module" ]; then
+  exit 1
+fi
+`
+
+// testModules creates the root modules in a temporary directory, where each
+// module is the list of modules it depends on, and returns the directory and
+// the path to the fake terraform binary
+func testModules(t *testing.T, modules map[string][]string) (string, string) {
+	root := t.TempDir()
+	for name, deps := range modules {
+		dir := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		var dependsOn = make([]string, 0, len(deps))
+		for _, dep := range deps {
+			dependsOn = append(dependsOn, "\"../"+dep+"\"")
+		}
+		contents := "exec {\n  depends_on = [" + strings.Join(dependsOn, ", ") + "]\n}\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "terraplate.hcl"), []byte(contents), 0644))
+	}
+	binary := filepath.Join(root, "terraform")
+	script := strings.Replace(fakeTerraform, "%s", root, 1)
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+	return root, binary
+}
+
+func touch(t *testing.T, path string) {
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+}
+
+// readLog returns the commands that the fake terraform binary ran, in order
+func readLog(t *testing.T, root string) []string {
+	contents, err := os.ReadFile(filepath.Join(root, "log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(contents)), "\n")
+}
+
+func newTestRunner(t *testing.T, root string, binary string, opts ...func(r *TerraRunOpts)) *Runner {
+	config, err := parser.Parse(&parser.Config{
+		Chdir: root,
+	})
+	require.NoError(t, err)
+	opts = append(opts, TerraformBinary(binary), Output(io.Discard))
+	return New(config, opts...)
+}
+
+// waitRunner waits for the runner, failing the test if it hangs
+func waitRunner(t *testing.T, r *Runner) {
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for runs to finish")
+	}
+}
+
+func moduleByName(t *testing.T, r *Runner, name string) *RootModule {
+	for _, mod := range r.Modules {
+		if filepath.Base(mod.Terrafile.Dir) == name {
+			return mod
+		}
+	}
+	t.Fatalf("module %s not found", name)
+	return nil
+}
+
+// moduleRun returns the run of the root module in the given directory
+func moduleRun(t *testing.T, r *Runner, name string) *TerraRun {
+	mod := moduleByName(t, r, name)
+	require.NotNil(t, mod.Run, "module %s has not run", name)
+	return mod.Run
+}
+
+func TestDependsOnOrder(t *testing.T) {
+	root, binary := testModules(t, map[string][]string{
+		"network":  nil,
+		"database": {"network"},
+		"app":      {"network", "database"},
+	})
+	// Without waiting for its dependencies, app would run first
+	touch(t, filepath.Join(root, "slow_network"))
+	touch(t, filepath.Join(root, "slow_database"))
+
+	r := newTestRunner(t, root, binary, RunInit())
+	r.Start(r.Modules)
+	waitRunner(t, r)
+
+	assert.False(t, r.HasError())
+	assert.Equal(t, []string{"network init", "database init", "app init"}, readLog(t, root))
+}
+
+func TestDependsOnDestroy(t *testing.T) {
+	root, binary := testModules(t, map[string][]string{
+		"network":  nil,
+		"database": {"network"},
+		"app":      {"network", "database"},
+	})
+	// Without waiting for its dependents, network would be destroyed first
+	touch(t, filepath.Join(root, "slow_app"))
+	touch(t, filepath.Join(root, "slow_database"))
+	touch(t, filepath.Join(root, "fail_app"))
+
+	r := newTestRunner(t, root, binary, RunPlan(), ExtraArgs([]string{"-destroy"}))
+	r.Start(r.Modules)
+	waitRunner(t, r)
+
+	assert.Equal(t, []string{"app plan"}, readLog(t, root))
+	assert.Equal(t, filepath.Join(root, "app"), moduleRun(t, r, "database").FailedDependency.Dir)
+	assert.NotNil(t, moduleRun(t, r, "network").FailedDependency)
+
+	// Once the dependents succeed, the modules run in reverse order
+	require.NoError(t, os.Remove(filepath.Join(root, "fail_app")))
+	require.NoError(t, os.Remove(filepath.Join(root, "log")))
+	r.Start(r.Modules)
+	waitRunner(t, r)
+
+	assert.False(t, r.HasError())
+	assert.Equal(t, []string{"app plan", "database plan", "network plan"}, readLog(t, root))
+}
+
+func TestDependsOnFailed(t *testing.T) {
+	root, binary := testModules(t, map[string][]string{
+		"network":  nil,
+		"database": {"network"},
+		"app":      {"database"},
+		"other":    nil,
+	})
+	touch(t, filepath.Join(root, "fail_network"))
+
+	r := newTestRunner(t, root, binary, RunInit())
+	r.Start(r.Modules)
+	waitRunner(t, r)
+
+	assert.True(t, moduleRun(t, r, "network").HasError())
+	// Dependents are skipped, including those depending on a skipped module
+	database := moduleRun(t, r, "database")
+	assert.Equal(t, filepath.Join(root, "network"), database.FailedDependency.Dir)
+	assert.Empty(t, database.Tasks)
+	app := moduleRun(t, r, "app")
+	assert.Equal(t, filepath.Join(root, "database"), app.FailedDependency.Dir)
+	assert.Empty(t, app.Tasks)
+	// Modules that do not depend on the failed module still run
+	other := moduleRun(t, r, "other")
+	assert.Nil(t, other.FailedDependency)
+	assert.False(t, other.HasError())
+	assert.ElementsMatch(t, []string{"network init", "other init"}, readLog(t, root))
+}
+
+func TestCancel(t *testing.T) {
+	root, binary := testModules(t, map[string][]string{
+		"first":  nil,
+		"queued": nil,
+		"app":    {"queued"},
+	})
+	touch(t, filepath.Join(root, "block_first"))
+
+	// With a single job, queued stays in the run queue whilst first is running
+	r := newTestRunner(t, root, binary, RunInit(), Jobs(1))
+	r.Start([]*RootModule{
+		moduleByName(t, r, "first"),
+		moduleByName(t, r, "queued"),
+		moduleByName(t, r, "app"),
+	})
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(root, "started_first"))
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	r.cancel()
+	// Cancelling again must not close the run queue twice
+	r.cancel()
+	touch(t, filepath.Join(root, "release"))
+	waitRunner(t, r)
+
+	assert.False(t, moduleRun(t, r, "first").HasError())
+	assert.True(t, moduleRun(t, r, "queued").Cancelled)
+	assert.NotNil(t, moduleRun(t, r, "app").FailedDependency)
+	assert.Equal(t, []string{"first init"}, readLog(t, root))
+
+	// Runs started after cancelling are cancelled too
+	r.Start([]*RootModule{moduleByName(t, r, "queued")})
+	waitRunner(t, r)
+	assert.True(t, moduleRun(t, r, "queued").Cancelled)
+}
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -15,6 +16,10 @@ type TaskResult struct {
 	ExecCmd  *exec.Cmd
 	TerraCmd terraCmd
 
+	// Version is the version of the terraform binary that ran the task, if
+	// known
+	Version *version.Version
+
 	Output  bytes.Buffer
 	Error   error
 	Skipped bool
@@ -40,7 +45,13 @@ func (t *TaskResult) Log() string {
 	switch t.TerraCmd {
 	case terraBuild:
 		summary.WriteString("Build output:\n\n")
+	case terraVersion:
+		summary.WriteString(fmt.Sprintf("Version output: %s\n\n", t.ExecCmd.String()))
 	default:
+		if t.Version != nil {
+			summary.WriteString(fmt.Sprintf("%s output (version %s): %s\n\n", caser.String(string(t.TerraCmd)), t.Version, t.ExecCmd.String()))
+			break
+		}
 		summary.WriteString(fmt.Sprintf("%s output: %s\n\n", caser.String(string(t.TerraCmd)), t.ExecCmd.String()))
 	}
 	if t.HasError() {
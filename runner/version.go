@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/verifa/terraplate/parser"
+)
+
+// binDirEnv is the environment variable that overrides the directory containing
+// the installed terraform versions
+const binDirEnv = "TERRAPLATE_BIN_DIR"
+
+// versionOutput is the output of `terraform version -json`. OpenTofu uses the
+// same format
+type versionOutput struct {
+	TerraformVersion string `json:"terraform_version"`
+}
+
+// versionCmd detects the version of the terraform binary and checks that it
+// satisfies the required_version of the terrafile
+func versionCmd(opts TerraRunOpts, tf *parser.Terrafile) (*TaskResult, *version.Version) {
+	task := runCmd(opts, tf, terraVersion, []string{"-json"})
+	if task.HasError() {
+		return task, nil
+	}
+	var output versionOutput
+	if err := json.Unmarshal(task.Output.Bytes(), &output); err != nil {
+		task.Error = fmt.Errorf("%s: parsing %s version output: %w", tf.Dir, tfBinary(opts, tf), err)
+		return task, nil
+	}
+	tfVersion, versionErr := version.NewVersion(output.TerraformVersion)
+	if versionErr != nil {
+		task.Error = fmt.Errorf("%s: parsing %s version \"%s\": %w", tf.Dir, tfBinary(opts, tf), output.TerraformVersion, versionErr)
+		return task, nil
+	}
+	if err := checkRequiredVersion(tf, tfVersion); err != nil {
+		task.Error = fmt.Errorf("%s: %s version %s: %w", tf.Dir, tfBinary(opts, tf), tfVersion, err)
+		return task, tfVersion
+	}
+	return task, tfVersion
+}
+
+// checkRequiredVersion returns an error if the version does not satisfy the
+// required_version of the terrafile
+func checkRequiredVersion(tf *parser.Terrafile, tfVersion *version.Version) error {
+	if tf.TerraformBlock == nil || tf.TerraformBlock.RequiredVersion == "" {
+		return nil
+	}
+	constraints, constraintErr := version.NewConstraint(tf.TerraformBlock.RequiredVersion)
+	if constraintErr != nil {
+		return fmt.Errorf("parsing required_version \"%s\": %w", tf.TerraformBlock.RequiredVersion, constraintErr)
+	}
+	if !constraints.Check(tfVersion) {
+		return fmt.Errorf("does not satisfy required_version \"%s\"", tf.TerraformBlock.RequiredVersion)
+	}
+	return nil
+}
+
+// binDir returns the directory containing the installed terraform versions,
+// which defaults to ~/.terraplate/bin
+func binDir() string {
+	if dir := os.Getenv(binDirEnv); dir != "" {
+		return dir
+	}
+	home, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		return ""
+	}
+	return filepath.Join(home, ".terraplate", "bin")
+}
+
+// installedBinary returns the path to the newest installed version of the
+// binary that satisfies the required_version of the terrafile, or an empty
+// string if there is none.
+// Installed versions are files in the bin directory named <binary>_<version>,
+// e.g. terraform_1.3.9, and nothing is ever downloaded
+func installedBinary(binary string, tf *parser.Terrafile) string {
+	dir := binDir()
+	if dir == "" {
+		return ""
+	}
+	entries, readErr := os.ReadDir(dir)
+	if readErr != nil {
+		// Without a bin directory fall back to the binary on the PATH
+		return ""
+	}
+	var constraints version.Constraints
+	if tf.TerraformBlock != nil && tf.TerraformBlock.RequiredVersion != "" {
+		var constraintErr error
+		constraints, constraintErr = version.NewConstraint(tf.TerraformBlock.RequiredVersion)
+		if constraintErr != nil {
+			// Let the version check report the invalid constraint
+			return ""
+		}
+	}
+	var (
+		newest     *version.Version
+		newestPath string
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), binary+"_") {
+			continue
+		}
+		entryVersion, versionErr := version.NewVersion(strings.TrimPrefix(entry.Name(), binary+"_"))
+		if versionErr != nil {
+			continue
+		}
+		if constraints != nil && !constraints.Check(entryVersion) {
+			continue
+		}
+		if newest == nil || entryVersion.GreaterThan(newest) {
+			newest = entryVersion
+			newestPath = filepath.Join(dir, entry.Name())
+		}
+	}
+	return newestPath
+}
@@ -0,0 +1,222 @@
+package runner
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/verifa/terraplate/parser"
+)
+
+// versionTerrafile returns a terrafile in a temporary directory with the
+// required_version and exec binary
+func versionTerrafile(t *testing.T, requiredVersion string, binary string) *parser.Terrafile {
+	return &parser.Terrafile{
+		Dir: t.TempDir(),
+		TerraformBlock: &parser.TerraformBlock{
+			RequiredVersion: requiredVersion,
+		},
+		ExecBlock: &parser.ExecBlock{
+			Binary: binary,
+		},
+	}
+}
+
+func TestCheckRequiredVersion(t *testing.T) {
+	tests := map[string]struct {
+		requiredVersion string
+		version         string
+		err             string
+	}{
+		"no required_version": {
+			version: "1.0.0",
+		},
+		"satisfied": {
+			requiredVersion: ">= 1.1.0, < 2.0.0",
+			version:         "1.3.9",
+		},
+		"not satisfied": {
+			requiredVersion: ">= 1.1.0",
+			version:         "1.0.11",
+			err:             "does not satisfy required_version \">= 1.1.0\"",
+		},
+		"invalid required_version": {
+			requiredVersion: "latest",
+			version:         "1.3.9",
+			err:             "parsing required_version \"latest\"",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tf := versionTerrafile(t, tc.requiredVersion, "")
+			err := checkRequiredVersion(tf, version.Must(version.NewVersion(tc.version)))
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestVersionCmd(t *testing.T) {
+	tests := map[string]struct {
+		// script is the fake terraform binary for `terraform version -json`
+		script          string
+		requiredVersion string
+		version         string
+		err             string
+	}{
+		"terraform": {
+			script:          `echo '{"terraform_version": "1.3.9", "platform": "linux_amd64"}'`,
+			requiredVersion: ">= 1.1.0",
+			version:         "1.3.9",
+		},
+		"not satisfied": {
+			script:          `echo '{"terraform_version": "1.0.11"}'`,
+			requiredVersion: ">= 1.1.0",
+			version:         "1.0.11",
+			err:             "version 1.0.11: does not satisfy required_version",
+		},
+		"invalid output": {
+			script: `echo 'Terraform v1.3.9'`,
+			err:    "parsing",
+		},
+		"invalid version": {
+			script: `echo '{"terraform_version": "dev"}'`,
+			err:    "version \"dev\"",
+		},
+		"command fails": {
+			script: `exit 1`,
+			err:    "running version command",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tf := versionTerrafile(t, tc.requiredVersion, "")
+			binary := filepath.Join(tf.Dir, "terraform")
+			require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\n"+tc.script+"\n"), 0755))
+
+			task, tfVersion := versionCmd(NewOpts(TerraformBinary(binary), Output(io.Discard)), tf)
+			if tc.version != "" {
+				require.NotNil(t, tfVersion)
+				assert.Equal(t, tc.version, tfVersion.String())
+			}
+			if tc.err != "" {
+				require.Error(t, task.Error)
+				assert.Contains(t, task.Error.Error(), tc.err)
+				return
+			}
+			require.NoError(t, task.Error)
+		})
+	}
+}
+
+func TestTfBinary(t *testing.T) {
+	// Make sure that installed versions do not affect the test
+	t.Setenv(binDirEnv, t.TempDir())
+	tests := map[string]struct {
+		flag     string
+		binary   string
+		expected string
+	}{
+		"default": {
+			expected: "terraform",
+		},
+		"exec binary": {
+			binary:   "tofu",
+			expected: "tofu",
+		},
+		"flag overrides exec binary": {
+			flag:     "terraform",
+			binary:   "tofu",
+			expected: "terraform",
+		},
+		"path": {
+			binary:   "/opt/terraform/bin/terraform",
+			expected: "/opt/terraform/bin/terraform",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tf := versionTerrafile(t, "", tc.binary)
+			assert.Equal(t, tc.expected, tfBinary(NewOpts(TerraformBinary(tc.flag)), tf))
+		})
+	}
+}
+
+func TestInstalledBinary(t *testing.T) {
+	binDir := t.TempDir()
+	t.Setenv(binDirEnv, binDir)
+	for _, name := range []string{
+		"terraform_1.0.11",
+		"terraform_1.3.9",
+		"terraform_1.2.0",
+		"terraform_2.0.0",
+		// Files that are not installed versions are skipped
+		"terraform_latest",
+		"terraform",
+		"tofu_1.6.0",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, name), nil, 0755))
+	}
+	// Directories are skipped, even if they look like a version
+	require.NoError(t, os.Mkdir(filepath.Join(binDir, "terraform_9.9.9"), os.ModePerm))
+
+	tests := map[string]struct {
+		binary          string
+		requiredVersion string
+		expected        string
+	}{
+		"newest": {
+			binary:   "terraform",
+			expected: "terraform_2.0.0",
+		},
+		"newest satisfying required_version": {
+			binary:          "terraform",
+			requiredVersion: "~> 1.2.0",
+			expected:        "terraform_1.2.0",
+		},
+		"none satisfying required_version": {
+			binary:          "terraform",
+			requiredVersion: "< 1.0.0",
+		},
+		"other binary": {
+			binary:   "tofu",
+			expected: "tofu_1.6.0",
+		},
+		"not installed": {
+			binary: "terragrunt",
+		},
+		"invalid required_version": {
+			binary:          "terraform",
+			requiredVersion: "latest",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tf := versionTerrafile(t, tc.requiredVersion, tc.binary)
+			expected := ""
+			if tc.expected != "" {
+				expected = filepath.Join(binDir, tc.expected)
+			}
+			assert.Equal(t, expected, installedBinary(tc.binary, tf))
+		})
+	}
+
+	// The installed version is used unless the binary is a path, falling back
+	// to the binary on the PATH
+	tf := versionTerrafile(t, ">= 1.1.0, < 1.3.0", "")
+	assert.Equal(t, filepath.Join(binDir, "terraform_1.2.0"), tfBinary(NewOpts(), tf))
+	tf = versionTerrafile(t, "< 1.0.0", "")
+	assert.Equal(t, "terraform", tfBinary(NewOpts(), tf))
+
+	// Without a bin directory, nothing is installed
+	t.Setenv(binDirEnv, filepath.Join(binDir, "missing"))
+	assert.Equal(t, "", installedBinary("terraform", versionTerrafile(t, "", "")))
+}
@@ -1,18 +1,32 @@
 package runner
 
-import (
-	"context"
-	"errors"
-)
-
 func (r *Runner) startWorker(workerID int) {
 	for run := range r.runQueue {
-		// Check if context has been cancelled
-		if errors.Is(r.ctx.Err(), context.Canceled) {
-			run.Cancelled = true
-		} else {
-			run.Run()
+		// Runs that were queued before the runner was cancelled are not
+		// executed. They are ended so that runs waiting for them do not hang
+		if r.ctx.Err() != nil {
+			r.cancelRun(run)
+			continue
 		}
+		run.Run()
 		r.wg.Done()
 	}
 }
+
+// scheduleAfter adds the run to the run queue once the runs of its
+// dependencies have finished. If any of the dependencies did not run
+// successfully, the run is skipped
+func (r *Runner) scheduleAfter(run *TerraRun, deps []*TerraRun) {
+	for _, dep := range deps {
+		dep.Wait()
+	}
+	for _, dep := range deps {
+		if dep.HasError() || dep.Cancelled || dep.FailedDependency != nil {
+			run.FailedDependency = dep.Terrafile
+			run.endRun()
+			r.wg.Done()
+			return
+		}
+	}
+	r.enqueue(run)
+}
@@ -42,6 +42,8 @@ func (i listItem) renderSummary() string {
 		summary.WriteString("Running...")
 	case run.HasError():
 		summary.WriteString("Error occurred.")
+	case run.FailedDependency != nil:
+		summary.WriteString(fmt.Sprintf("Skipped: %s did not run successfully.", run.FailedDependency.Dir))
 	case run.IsApplied():
 		summary.WriteString("Applied.")
 	case !run.HasPlan():